@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// mpuCheckpointSuffix is appended to the local filename to get the MPU checkpoint filename
+	mpuCheckpointSuffix = ".s3cli-mpu"
+	// getCheckpointSuffix is appended to the local filename to get the download checkpoint filename
+	getCheckpointSuffix = ".s3cli-get"
+)
+
+// mpuCheckpoint record the progress of a local file's Multi-Part-Upload
+type mpuCheckpoint struct {
+	mu   sync.Mutex
+	path string // checkpoint filename
+
+	Bucket   string           `json:"bucket"`
+	Key      string           `json:"key"`
+	UploadID string           `json:"uploadId"`
+	PartSize int64            `json:"partSize"`
+	Size     int64            `json:"size"`
+	ModTime  time.Time        `json:"modTime"`
+	Parts    map[int64]string `json:"parts"` // completed part number to ETag
+}
+
+// readCheckpoint decode a checkpoint file into v, return false if the file not exist
+func readCheckpoint(path string, v interface{}) (bool, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("invalid checkpoint %s: %w", path, err)
+	}
+	return true, nil
+}
+
+// writeCheckpoint encode v into a checkpoint file
+func writeCheckpoint(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	// write to a temp file and rename it, never leave a truncated checkpoint
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// removeCheckpoint delete a checkpoint file
+func removeCheckpoint(path string) error {
+	err := os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// loadMpuCheckpoint load a MPU checkpoint file, return nil if the file not exist
+func loadMpuCheckpoint(path string) (*mpuCheckpoint, error) {
+	cp := &mpuCheckpoint{path: path}
+	if ok, err := readCheckpoint(path, cp); !ok {
+		return nil, err
+	}
+	if cp.Parts == nil {
+		cp.Parts = map[int64]string{}
+	}
+	return cp, nil
+}
+
+// match check if the checkpoint records the same upload of an unchanged local file
+func (cp *mpuCheckpoint) match(bucket, key string, fi os.FileInfo) bool {
+	return cp.Bucket == bucket && cp.Key == key && cp.Size == fi.Size() && cp.ModTime.Equal(fi.ModTime())
+}
+
+// part return the recorded ETag of part num
+func (cp *mpuCheckpoint) part(num int64) (string, bool) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	etag, ok := cp.Parts[num]
+	return etag, ok
+}
+
+// setPart record a completed part and save the checkpoint
+func (cp *mpuCheckpoint) setPart(num int64, etag string) error {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.Parts[num] = etag
+	return cp.saveLocked()
+}
+
+// save write the checkpoint to its file
+func (cp *mpuCheckpoint) save() error {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	return cp.saveLocked()
+}
+
+func (cp *mpuCheckpoint) saveLocked() error {
+	return writeCheckpoint(cp.path, cp)
+}
+
+// remove delete the checkpoint file
+func (cp *mpuCheckpoint) remove() error {
+	return removeCheckpoint(cp.path)
+}
+
+// getCheckpoint record the Object being downloaded to a local file,
+// the partial local file can only be continued if the Object is unchanged
+type getCheckpoint struct {
+	path string // checkpoint(sidecar) filename
+
+	Bucket       string    `json:"bucket"`
+	Key          string    `json:"key"`
+	VersionID    string    `json:"versionId,omitempty"`
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"lastModified"`
+	Size         int64     `json:"size"`
+}
+
+// loadGetCheckpoint load a download checkpoint file, return nil if the file not exist
+func loadGetCheckpoint(path string) (*getCheckpoint, error) {
+	cp := &getCheckpoint{path: path}
+	if ok, err := readCheckpoint(path, cp); !ok {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// save write the checkpoint to its file
+func (cp *getCheckpoint) save() error {
+	return writeCheckpoint(cp.path, cp)
+}
+
+// remove delete the checkpoint file
+func (cp *getCheckpoint) remove() error {
+	return removeCheckpoint(cp.path)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// sha256MetaKey is the user metadata(x-amz-meta-sha256) of the SHA-256 of a MPU Object
+const sha256MetaKey = "sha256"
+
+// contentMD5 return the base64 MD5(Content-MD5) of r from current offset, and seek r back
+func contentMD5(r io.ReadSeeker) (string, error) {
+	offset, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "", err
+	}
+	h := md5.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// partSums read size bytes of r once, return the hex SHA-256 of all bytes
+// and the base64 MD5(Content-MD5) of each partSize part
+func partSums(r io.ReaderAt, size, partSize int64) (string, []string, error) {
+	h := sha256.New()
+	var md5s []string
+	for offset := int64(0); offset < size; offset += partSize {
+		n := partSize
+		if offset+n > size {
+			n = size - offset
+		}
+		m := md5.New()
+		if _, err := io.Copy(io.MultiWriter(h, m), io.NewSectionReader(r, offset, n)); err != nil {
+			return "", nil, err
+		}
+		md5s = append(md5s, base64.StdEncoding.EncodeToString(m.Sum(nil)))
+	}
+	return hex.EncodeToString(h.Sum(nil)), md5s, nil
+}
+
+// fileSHA256 return the hex SHA-256 of a local file
+func fileSHA256(filename string) (string, error) {
+	fd, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, fd); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// metaValue return the value of user metadata key, case insensitive
+func metaValue(meta map[string]*string, key string) string {
+	for k, v := range meta {
+		if strings.EqualFold(k, key) {
+			return aws.StringValue(v)
+		}
+	}
+	return ""
+}
+
+// verifyFile verify a downloaded file against the SHA-256 in user metadata,
+// or the ETag if it is a MD5(single part, not SSE-KMS/SSE-C Object).
+// The file is removed if mismatch
+func verifyFile(filename string, etag *string, meta map[string]*string, encrypted bool) error {
+	var want, got string
+	var err error
+	if want = metaValue(meta, sha256MetaKey); want != "" {
+		got, err = fileSHA256(filename)
+	} else if md5sum, ok := etagMD5(etag); ok && !encrypted {
+		want = md5sum
+		got, err = fileMD5(filename)
+	} else {
+		return nil // nothing to verify
+	}
+	if err != nil {
+		return fmt.Errorf("checksum %s failed: %w", filename, err)
+	}
+	if got != want {
+		if e := os.Remove(filename); e != nil {
+			return fmt.Errorf("%s checksum mismatch(expect %s, got %s), remove it failed: %w", filename, want, got, e)
+		}
+		return fmt.Errorf("%s checksum mismatch(expect %s, got %s), removed", filename, want, got)
+	}
+	return nil
+}
+
+// sseEncrypted check if the Object is encrypted by SSE-KMS or SSE-C, whose ETag is not a MD5
+func sseEncrypted(sse, sseCustomerAlgorithm *string) bool {
+	return aws.StringValue(sse) == s3.ServerSideEncryptionAwsKms || sseCustomerAlgorithm != nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func Test_contentMD5(t *testing.T) {
+	r := bytes.NewReader([]byte("skip-hello"))
+	r.Seek(5, 0)
+	sum, err := contentMD5(r)
+	if err != nil {
+		t.Fatalf("contentMD5 failed: %s", err)
+	}
+	if sum != "XUFAKrxLKna5cZ2REBfFkg==" {
+		t.Errorf("contentMD5 got %s", sum)
+	}
+	if n := r.Len(); n != 5 {
+		t.Errorf("contentMD5 not seek back, %d bytes left", n)
+	}
+}
+
+func Test_partSums(t *testing.T) {
+	data := []byte("hello world")
+	sum, md5s, err := partSums(bytes.NewReader(data), int64(len(data)), 5)
+	if err != nil {
+		t.Fatalf("partSums failed: %s", err)
+	}
+	sha256sum := sha256.Sum256(data)
+	if sum != hex.EncodeToString(sha256sum[:]) {
+		t.Errorf("partSums SHA-256 got %s", sum)
+	}
+	for i, part := range []string{"hello", " worl", "d"} {
+		r := bytes.NewReader([]byte(part))
+		if want, _ := contentMD5(r); i >= len(md5s) || md5s[i] != want {
+			t.Errorf("partSums part %d MD5 expect %s, got %v", i+1, want, md5s)
+		}
+	}
+	if len(md5s) != 3 {
+		t.Errorf("partSums expect 3 parts, got %d", len(md5s))
+	}
+}
+
+func Test_verifyFile(t *testing.T) {
+	dir := t.TempDir()
+	data := []byte("verifyFile")
+	md5sum := md5.Sum(data)
+	sha256sum := sha256.Sum256(data)
+	etag := aws.String(fmt.Sprintf(`"%s"`, hex.EncodeToString(md5sum[:])))
+	badEtag := aws.String(`"0123456789abcdef0123456789abcdef"`)
+	meta := map[string]*string{"Sha256": aws.String(hex.EncodeToString(sha256sum[:]))}
+	badMeta := map[string]*string{"Sha256": aws.String("bad")}
+
+	tests := []struct {
+		name      string
+		etag      *string
+		meta      map[string]*string
+		encrypted bool
+		wantErr   bool
+	}{
+		{"md5", etag, nil, false, false},
+		{"md5 mismatch", badEtag, nil, false, true},
+		{"encrypted etag", badEtag, nil, true, false},
+		{"mpu etag", aws.String(`"0123456789abcdef0123456789abcdef-2"`), nil, false, false},
+		{"sha256", badEtag, meta, false, false},
+		{"sha256 mismatch", etag, badMeta, false, true},
+	}
+	for _, tt := range tests {
+		filename := filepath.Join(dir, "file")
+		if err := ioutil.WriteFile(filename, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		err := verifyFile(filename, tt.etag, tt.meta, tt.encrypted)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("verifyFile %s error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		if _, e := os.Stat(filename); tt.wantErr != os.IsNotExist(e) {
+			t.Errorf("verifyFile %s should remove file only if mismatch, stat: %v", tt.name, e)
+		}
+	}
+}
+
+func Test_getVerify(t *testing.T) {
+	dir := t.TempDir()
+	filename, data := writeRandomFile(t, dir, "file", 1000)
+	sc := s3cliTest
+	sc.mpuThreshold = 300
+	sc.partSize = 300
+	sc.concurrency = 2
+	key := "testGetVerify"
+	if err := sc.putFile(testBucketName, key, filename); err != nil {
+		t.Fatalf("putFile failed: %s", err)
+	}
+	head, err := sc.statObject(testBucketName, key, "")
+	if err != nil {
+		t.Fatalf("statObject failed: %s", err)
+	}
+	sum := sha256.Sum256(data)
+	if got := metaValue(head.Metadata, sha256MetaKey); got != hex.EncodeToString(sum[:]) {
+		t.Errorf("MPU put metadata sha256 = %q, want %x", got, sum)
+	}
+	for _, concurrency := range []int{1, 2} {
+		sc.concurrency = concurrency
+		if err := sc.downloadObject(testBucketName, key, "", filepath.Join(dir, "get")); err != nil {
+			t.Errorf("downloadObject(concurrency %d) verify failed: %s", concurrency, err)
+		}
+	}
+
+	// an Object with wrong SHA-256 fails and the downloaded file is removed
+	bad := "testGetVerifyBad"
+	_, err = s3Backend.PutObject(testBucketName, bad, map[string]string{"X-Amz-Meta-Sha256": "bad"}, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("backend PutObject failed: %s", err)
+	}
+	for _, concurrency := range []int{1, 2} {
+		sc.concurrency = concurrency
+		out := filepath.Join(dir, "bad")
+		if err := sc.downloadObject(testBucketName, bad, "", out); err == nil {
+			t.Errorf("downloadObject(concurrency %d) bad checksum should fail", concurrency)
+		}
+		if _, err := os.Stat(out); !os.IsNotExist(err) {
+			t.Errorf("downloadObject(concurrency %d) bad file not removed: %v", concurrency, err)
+		}
+	}
+}
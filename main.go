@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -47,6 +48,96 @@ func splitBucketObject(bucketObject string) (bucket, object string) {
 	return bucketObject, ""
 }
 
+// splitBucketPrefix split bucket/prefix and make sure the prefix ends with / like a dir
+func splitBucketPrefix(bucketPrefix string) (bucket, prefix string) {
+	bucket, prefix = splitBucketObject(bucketPrefix)
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return bucket, prefix
+}
+
+// parseSize parse size string(1024, 64K, 16M, 1G, 1T) to bytes
+func parseSize(size string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(size))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+	unit := int64(1)
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'K':
+			unit = 1 << 10
+		case 'M':
+			unit = 1 << 20
+		case 'G':
+			unit = 1 << 30
+		case 'T':
+			unit = 1 << 40
+		}
+		if unit > 1 {
+			s = s[:n-1]
+		}
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid size: %s", size)
+	}
+	return v * unit, nil
+}
+
+// isPartFile check if arg is a part-num:file argument of mpu upload
+func isPartFile(arg string) bool {
+	i := strings.Index(arg, ":")
+	if i < 1 {
+		return false
+	}
+	_, err := strconv.ParseInt(arg[:i], 10, 64)
+	return err == nil
+}
+
+// parsePartNumbers parse part numbers(1,3,5-7) to sorted unique part numbers
+func parsePartNumbers(parts string) ([]int64, error) {
+	set := map[int64]bool{}
+	for _, v := range strings.Split(parts, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		start, end := v, v
+		if i := strings.Index(v, "-"); i > 0 {
+			start, end = v[:i], v[i+1:]
+		}
+		first, err := strconv.ParseInt(start, 10, 64)
+		if err != nil || first < 1 {
+			return nil, fmt.Errorf("invalid part number: %s", v)
+		}
+		last, err := strconv.ParseInt(end, 10, 64)
+		if err != nil || last < first || last > maxPartNum {
+			return nil, fmt.Errorf("invalid part number: %s", v)
+		}
+		for num := first; num <= last; num++ {
+			set[num] = true
+		}
+	}
+	nums := make([]int64, 0, len(set))
+	for num := range set {
+		nums = append(nums, num)
+	}
+	sort.Slice(nums, func(i, j int) bool { return nums[i] < nums[j] })
+	return nums, nil
+}
+
+// isLocalPath check if path is a local path(absolute, start with . or exists) rather than bucket[/prefix]
+func isLocalPath(path string) bool {
+	if path == "" {
+		return false
+	}
+	if filepath.IsAbs(path) || strings.HasPrefix(path, ".") {
+		return true
+	}
+	_, err := os.Stat(path)
+	return err == nil
+}
+
 func newS3Client(sc *S3Cli) (*s3.S3, error) {
 	if sc.ak != "" && sc.sk != "" {
 		os.Setenv("AWS_ACCESS_KEY_ID", sc.ak)
@@ -59,6 +150,28 @@ func newS3Client(sc *S3Cli) (*s3.S3, error) {
 	if !virtualhost {
 		sess.Config.S3ForcePathStyle = aws.Bool(true)
 	}
+	if sc.limitRate > 0 || sc.progress != nil {
+		// wrap the transport of session(maybe customized by AWS_CA_BUNDLE)
+		client := http.Client{}
+		if sess.Config.HTTPClient != nil {
+			client = *sess.Config.HTTPClient
+		}
+		transport := client.Transport
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+		if sc.limitRate > 0 {
+			transport = &limitTransport{
+				base:    transport,
+				limiter: newRateLimiter(sc.limitRate),
+			}
+		}
+		if sc.progress != nil {
+			transport = &progressTransport{base: transport}
+		}
+		client.Transport = transport
+		sess.Config.HTTPClient = &client
+	}
 
 	svc := s3.New(sess)
 
@@ -81,7 +194,15 @@ Credential EnvVar:
 	AWS_SECRET_KEY=SK         (only read if AWS_SECRET_ACCESS_KEY is not set)`,
 		Version: version,
 		Hidden:  true,
-		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) (err error) {
+			if sc.limitRate, err = parseSize(cmd.Flag("limit-rate").Value.String()); err != nil {
+				return fmt.Errorf("invalid limit-rate: %w", err)
+			}
+			if f := cmd.Flags().Lookup("progress"); f != nil && !sc.presign {
+				if sc.progress, err = newProgress(f.Value.String()); err != nil {
+					return err
+				}
+			}
 			// mannual init S3 client
 			client, err := newS3Client(&sc)
 			if err != nil {
@@ -100,6 +221,7 @@ Credential EnvVar:
 	rootCmd.PersistentFlags().StringVarP(&sc.region, "region", "R", s3.BucketLocationConstraintCnNorth1, "S3 region")
 	rootCmd.PersistentFlags().StringVarP(&sc.ak, "ak", "", "", "access key")
 	rootCmd.PersistentFlags().StringVarP(&sc.sk, "sk", "", "", "secret key")
+	rootCmd.PersistentFlags().StringP("limit-rate", "", "0", "limit bandwidth of all transfers(20M means 20MiB/s, 0 means no limit)")
 	// pathStyle
 	rootCmd.PersistentFlags().BoolVarP(&virtualhost, "virtualhost", "", false, "use virtualhosting style(not use path style)")
 
@@ -313,7 +435,7 @@ Credential EnvVar:
 
 	// object put(upload)
 	putObjectCmd := &cobra.Command{
-		Use:     "put <bucket[/key]> [<local-file> ...]",
+		Use:     "put <bucket[/key]> [<local-file> ...|-]",
 		Aliases: []string{"up", "upload"},
 		Short:   "put Object(s)",
 		Long: `put(upload) Object(s) usage:
@@ -327,42 +449,75 @@ Credential EnvVar:
 * put(upload) files to Bucket with specified common prefix(dir/)
 	s3cli put bucket/dir/ file1 file2 file3
 	s3cli up bucket/dir2/ *.txt
+* put(upload) stdin to Bucket/Key, by MPU if stdin exceeds part size
+	tar c dir | s3cli put bucket/dir.tar -
+* put(upload) all files in local dir to Bucket with specified common prefix(dir/), 8 files in parallel
+	s3cli put -r bucket/dir/ /path/to/dir --jobs 8
+* put(upload) a large file by MPU(file size > 64M) with 32M part size and 8 parallel parts
+	s3cli put bucket/key /path/to/large-file --part-size 32M --concurrency 8
+* put(upload) a large file by MPU, with --resume progress is recorded in /path/to/large-file.s3cli-mpu,
+  rerun with --resume to continue an interrupted upload
+	s3cli put bucket/key /path/to/large-file --resume
+* put(upload) a large file and emit newline-delimited JSON progress events to stderr
+	s3cli put bucket/key /path/to/large-file --progress=json
 * presign(V4) a PUT Object URL
 	s3cli up bucket/key --presign`,
 		Args: cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			if sc.mpuThreshold, err = parseSize(cmd.Flag("mpu-threshold").Value.String()); err != nil {
+				return err
+			}
+			if sc.partSize, err = parseSize(cmd.Flag("part-size").Value.String()); err != nil {
+				return err
+			}
+			if sc.concurrency, err = cmd.Flags().GetInt("concurrency"); err != nil {
+				return err
+			}
+			sc.resume = cmd.Flag("resume").Changed
+			sc.startProgress()
+			defer sc.stopProgress()
 			var fd *os.File
 			bucket, key := splitBucketObject(args[0])
+			if cmd.Flag("recursive").Changed {
+				if len(args) != 2 {
+					return fmt.Errorf("put -r requires <bucket[/prefix]> <local-dir>")
+				}
+				jobs, err := cmd.Flags().GetInt("jobs")
+				if err != nil {
+					return err
+				}
+				return sc.putDir(bucket, key, args[1], jobs)
+			}
 			if len(args) < 2 { // upload zero-size file
 				err = sc.putObject(bucket, key, fd)
+			} else if len(args) == 2 && args[1] == "-" { // upload stdin
+				if key == "" || strings.HasSuffix(key, "/") {
+					return fmt.Errorf("key is required to put stdin")
+				}
+				err = sc.putStream(bucket, key, os.Stdin)
 			} else if len(args) == 2 { // upload one file
 				if key == "" {
 					key = filepath.Base(args[1])
 				}
-				fd, err = os.Open(args[1])
-				if err != nil {
-					return err
-				}
-				defer fd.Close()
-				err = sc.putObject(bucket, key, fd)
+				err = sc.putFile(bucket, key, args[1])
 			} else { // upload multi files
 				for _, v := range args[1:] {
 					newKey := fmt.Sprintf("%s%s", key, filepath.Base(v))
-					fd, err = os.Open(v)
-					if err != nil {
-						return err
-					}
-					err = sc.putObject(bucket, newKey, fd)
-					if err != nil {
-						fd.Close()
+					if err = sc.putFile(bucket, newKey, v); err != nil {
 						return err
 					}
-					fd.Close()
 				}
 			}
 			return
 		},
 	}
+	putObjectCmd.Flags().StringP("mpu-threshold", "", "64M", "put file by MPU if file size exceeds threshold(0 to disable MPU), MPU reads the whole file once before upload to save its SHA-256")
+	putObjectCmd.Flags().StringP("part-size", "", "16M", "MPU part size(at least 5M)")
+	putObjectCmd.Flags().IntP("concurrency", "c", 4, "number of parallel MPU parts")
+	putObjectCmd.Flags().BoolP("resume", "", false, "continue an interrupted MPU from its checkpoint file")
+	putObjectCmd.Flags().BoolP("recursive", "r", false, "put(upload) all files in local dir recursively")
+	putObjectCmd.Flags().IntP("jobs", "j", 4, "number of parallel file uploads in recursive mode")
+	putObjectCmd.Flags().StringP("progress", "", progressAuto, "show progress to stderr: auto(if stdout is a terminal), json or none")
 	rootCmd.AddCommand(putObjectCmd)
 
 	headCmd := &cobra.Command{
@@ -584,13 +739,25 @@ Credential EnvVar:
 * list Object Versions
 	s3cli lv bucket-name
 * list Object Versions with specified prefix
-	s3cli lv bucket-name/prefix`,
+	s3cli lv bucket-name/prefix
+* list Object Versions(2020-03-03 00:00:00 < modifyTime < 2020-06-03 00:00:00)
+	s3cli lv bucket-name --start-time '2020-03-03 00:00:00' --end-time '2020-06-03 00:00:00'`,
 		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
+			stime, err := time.Parse("2006-01-02 15:04:05", cmd.Flag("start-time").Value.String())
+			if err != nil {
+				return fmt.Errorf("invalid start-time %s, error %s", cmd.Flag("start-time").Value.String(), err)
+			}
+			etime, err := time.Parse("2006-01-02 15:04:05", cmd.Flag("end-time").Value.String())
+			if err != nil {
+				return fmt.Errorf("invalid end-time %s, error %s", cmd.Flag("end-time").Value.String(), err)
+			}
 			bucket, prefix := splitBucketObject(args[0])
-			return sc.listObjectVersions(bucket, prefix)
+			return sc.listObjectVersions(bucket, prefix, stime, etime)
 		},
 	}
+	listVersionCmd.Flags().StringP("start-time", "", "2006-01-02 15:04:05", "show versions modify-time after start-time(UTC)")
+	listVersionCmd.Flags().StringP("end-time", "", "2080-01-02 15:04:05", "show versions modify-time before end-time(UTC)")
 	rootCmd.AddCommand(listVersionCmd)
 
 	getObjectCmd := &cobra.Command{
@@ -602,13 +769,51 @@ Credential EnvVar:
 	s3cli get bucket/key
 * get(download) a Object to /path/to/file
 	s3cli get bucket/key /path/to/file
+* get(download) a Object by 8 parallel ranged GET with 32M part size
+	s3cli get bucket/key --concurrency 8 --part-size 32M
+* continue an interrupted get(download) if the Object is unchanged
+	s3cli get bucket/key /path/to/file --continue
+* get(download) a range(0-64 means [0, 64]) of Object
+	s3cli get bucket/key /path/to/file --range 0-64
+* get(download) all Objects with prefix(dir/) to local dir, 8 Objects in parallel
+	s3cli get --recursive bucket/dir/ /path/to/dir --jobs 8
 * presign(V4) a get(download) Object URL
 	s3cli get bucket/key --presign`,
 		Args: cobra.RangeArgs(1, 2),
-		RunE: func(cmd *cobra.Command, args []string) error {
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
 			bucket, key := splitBucketObject(args[0])
 			objRange := cmd.Flag("range").Value.String()
 			version := cmd.Flag("version").Value.String()
+			filename := filepath.Base(key)
+			if len(args) == 2 {
+				filename = args[1]
+			}
+			sc.startProgress()
+			defer sc.stopProgress()
+			if objRange == "" && !sc.presign {
+				if sc.partSize, err = parseSize(cmd.Flag("part-size").Value.String()); err != nil {
+					return err
+				}
+				if sc.concurrency, err = cmd.Flags().GetInt("concurrency"); err != nil {
+					return err
+				}
+				sc.resume = cmd.Flag("continue").Changed
+				if sc.resume && cmd.Flag("concurrency").Changed {
+					return fmt.Errorf("--continue downloads sequentially, not work with --concurrency")
+				}
+				if cmd.Flag("recursive").Changed {
+					dir := "."
+					if len(args) == 2 {
+						dir = args[1]
+					}
+					jobs, err := cmd.Flags().GetInt("jobs")
+					if err != nil {
+						return err
+					}
+					return sc.getPrefix(bucket, key, dir, jobs)
+				}
+				return sc.downloadObject(bucket, key, version, filename)
+			}
 			r, err := sc.getObject(bucket, key, objRange, version)
 			if err != nil {
 				return err
@@ -617,10 +822,6 @@ Credential EnvVar:
 				return nil
 			}
 			defer r.Close()
-			filename := filepath.Base(key)
-			if len(args) == 2 {
-				filename = args[1]
-			}
 			// Create a file to write the S3 Object contents
 			fd, err := os.Create(filename)
 			if err != nil {
@@ -634,6 +835,12 @@ Credential EnvVar:
 	getObjectCmd.Flags().StringP("range", "r", "", "Object range to download, 0-64 means [0, 64]")
 	getObjectCmd.Flags().StringP("version", "", "", "Object version ID to delete")
 	getObjectCmd.Flags().BoolP("overwrite", "w", false, "overwrite file if exist")
+	getObjectCmd.Flags().StringP("part-size", "", "16M", "ranged GET part size")
+	getObjectCmd.Flags().IntP("concurrency", "c", 1, "number of parallel ranged GET")
+	getObjectCmd.Flags().BoolP("continue", "", false, "continue a partial download if the Object is unchanged")
+	getObjectCmd.Flags().BoolP("recursive", "", false, "get(download) all Objects with prefix recursively")
+	getObjectCmd.Flags().IntP("jobs", "j", 4, "number of parallel Object downloads in recursive mode")
+	getObjectCmd.Flags().StringP("progress", "", progressAuto, "show progress to stderr: auto(if stdout is a terminal), json or none")
 	rootCmd.AddCommand(getObjectCmd)
 
 	catObjectCmd := &cobra.Command{
@@ -641,7 +848,9 @@ Credential EnvVar:
 		Short: "cat Object",
 		Long: `cat Object contents usage:
 * cat a Object
-	s3cli cat bucket/key`,
+	s3cli cat bucket/key
+* cat a range(0-64 means [0, 64]) of Object
+	s3cli cat bucket/key --range 0-64`,
 		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			objRange := cmd.Flag("range").Value.String()
@@ -662,16 +871,38 @@ Credential EnvVar:
 * specify destination key
 	s3cli mv bucket/key1 bucket2/key2
 * default destionation key
-	s3cli mv bucket/key1 bucket2`,
+	s3cli mv bucket/key1 bucket2
+* rename all Objects with prefix(old/) to prefix(new/), 8 Objects in parallel
+	s3cli mv -r bucket/old/ bucket/new/ --jobs 8`,
 		Args: cobra.ExactArgs(2),
-		RunE: func(cmd *cobra.Command, args []string) error {
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			if sc.partSize, err = parseSize(cmd.Flag("part-size").Value.String()); err != nil {
+				return err
+			}
+			if sc.concurrency, err = cmd.Flags().GetInt("concurrency"); err != nil {
+				return err
+			}
+			if cmd.Flag("recursive").Changed {
+				jobs, err := cmd.Flags().GetInt("jobs")
+				if err != nil {
+					return err
+				}
+				srcBucket, srcPrefix := splitBucketPrefix(args[0])
+				bucket, prefix := splitBucketPrefix(args[1])
+				return sc.renamePrefix(srcBucket, srcPrefix, bucket, prefix, jobs)
+			}
+			srcBucket, srcKey := splitBucketObject(args[0])
 			bucket, key := splitBucketObject(args[1])
 			if key == "" {
-				_, key = splitBucketObject(args[0])
+				key = srcKey
 			}
-			return sc.renameObject(args[0], bucket, key)
+			return sc.renameObject(srcBucket, srcKey, bucket, key)
 		},
 	}
+	renameObjectCmd.Flags().BoolP("recursive", "r", false, "rename all Objects with prefix")
+	renameObjectCmd.Flags().IntP("jobs", "j", 4, "number of parallel Object renames in recursive mode")
+	renameObjectCmd.Flags().StringP("part-size", "", "512M", "MPU copy part size of Object larger than 5G")
+	renameObjectCmd.Flags().IntP("concurrency", "c", 4, "number of parallel MPU copy parts")
 	rootCmd.AddCommand(renameObjectCmd)
 
 	copyObjectCmd := &cobra.Command{
@@ -682,47 +913,205 @@ Credential EnvVar:
 * spedify destination key
 	s3cli copy bucket/key1 bucket2/key2
 * default destionation key
-	s3cli copy bucket/key1 bucket2`,
+	s3cli copy bucket/key1 bucket2
+* copy a Object larger than 5G by MPU with 1G part size and 8 parallel parts(metadata carried)
+	s3cli copy bucket/large-key bucket2/large-key --part-size 1G --concurrency 8`,
 		Args: cobra.ExactArgs(2),
-		RunE: func(cmd *cobra.Command, args []string) error {
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			if sc.partSize, err = parseSize(cmd.Flag("part-size").Value.String()); err != nil {
+				return err
+			}
+			if sc.concurrency, err = cmd.Flags().GetInt("concurrency"); err != nil {
+				return err
+			}
+			srcBucket, srcKey := splitBucketObject(args[0])
 			bucket, key := splitBucketObject(args[1])
 			if key == "" {
-				_, key = splitBucketObject(args[0])
+				key = srcKey
 			}
-			return sc.copyObject(args[0], bucket, key)
+			return sc.copyObject(srcBucket, srcKey, "", -1, bucket, key)
 		},
 	}
+	copyObjectCmd.Flags().StringP("part-size", "", "512M", "MPU copy part size of Object larger than 5G")
+	copyObjectCmd.Flags().IntP("concurrency", "c", 4, "number of parallel MPU copy parts")
 	rootCmd.AddCommand(copyObjectCmd)
 
+	restoreVersionCmd := &cobra.Command{
+		Use:   "restore-version <bucket/key> [versionId]",
+		Short: "restore Object to a previous version",
+		Long: `restore Object to a previous version(copy the version over current version) usage:
+* restore Object to a version
+	s3cli restore-version bucket/key versionId
+* restore Object to the latest version before a time(UTC)
+	s3cli restore-version bucket/key --before '2020-06-03 00:00:00'`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			bucket, key := splitBucketObject(args[0])
+			if key == "" {
+				return fmt.Errorf("key is required")
+			}
+			var version string
+			if cmd.Flag("before").Changed {
+				if len(args) == 2 {
+					return fmt.Errorf("versionId is not allowed with --before")
+				}
+				before, err := time.Parse("2006-01-02 15:04:05", cmd.Flag("before").Value.String())
+				if err != nil {
+					return fmt.Errorf("invalid before %s, error %s", cmd.Flag("before").Value.String(), err)
+				}
+				if version, err = sc.versionBefore(bucket, key, before); err != nil {
+					return err
+				}
+			} else if len(args) == 2 {
+				version = args[1]
+			} else {
+				return fmt.Errorf("versionId or --before is required")
+			}
+			if sc.partSize, err = parseSize(cmd.Flag("part-size").Value.String()); err != nil {
+				return err
+			}
+			if sc.concurrency, err = cmd.Flags().GetInt("concurrency"); err != nil {
+				return err
+			}
+			return sc.restoreVersion(bucket, key, version)
+		},
+	}
+	restoreVersionCmd.Flags().StringP("before", "", "", "restore the latest version modified before the time(UTC)")
+	restoreVersionCmd.Flags().StringP("part-size", "", "512M", "MPU copy part size of Object larger than 5G")
+	restoreVersionCmd.Flags().IntP("concurrency", "c", 4, "number of parallel MPU copy parts")
+	rootCmd.AddCommand(restoreVersionCmd)
+
+	undeleteCmd := &cobra.Command{
+		Use:   "undelete <bucket/key>",
+		Short: "undelete Object(s)",
+		Long: `undelete Object(s) in versioned Bucket(remove delete markers to bring previous version back) usage:
+* undelete a Object
+	s3cli undelete bucket/key
+* undelete all deleted Objects with prefix(dir/)
+	s3cli undelete -r bucket/dir/`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			jobs, err := cmd.Flags().GetInt("jobs")
+			if err != nil {
+				return err
+			}
+			bucket, key := splitBucketObject(args[0])
+			recursive := cmd.Flag("recursive").Changed
+			if key == "" && !recursive {
+				return fmt.Errorf("key is required without -r")
+			}
+			return sc.undelete(bucket, key, recursive, jobs)
+		},
+	}
+	undeleteCmd.Flags().BoolP("recursive", "r", false, "undelete all deleted Objects with prefix")
+	undeleteCmd.Flags().IntP("jobs", "j", 4, "number of parallel undelete in recursive mode")
+	rootCmd.AddCommand(undeleteCmd)
+
 	deleteObjectCmd := &cobra.Command{
 		Use:     "delete <bucket/key>",
 		Aliases: []string{"del", "rm"},
 		Short:   "delete Object or Bucket",
 		Long: `delete Bucket or Object(s) usage:
-* delete Bucket and all Objects
-	s3cli delete bucket
+* delete Bucket and all Object versions, delete markers and MPU
+	s3cli delete bucket --force
 * delete a Object
 	s3cli delete bucket/key
 * delete all Objects with same Prefix
-	s3cli delete bucket/prefix -x`,
+	s3cli delete bucket/prefix -x
+* delete all Objects with same Prefix, 8 DeleteObjects(1000 Objects each) in flight
+	s3cli delete bucket/prefix -x --jobs 8`,
 		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			prefixMode := cmd.Flag("prefix").Changed
 			force := cmd.Flag("force").Changed
+			jobs, err := cmd.Flags().GetInt("jobs")
+			if err != nil {
+				return err
+			}
 			bucket, key := splitBucketObject(args[0])
 			if prefixMode {
-				return sc.deleteObjects(bucket, key)
+				return sc.deleteObjects(bucket, key, jobs)
 			} else if key != "" {
 				return sc.deleteObject(bucket, key, cmd.Flag("version").Value.String())
 			}
-			return sc.deleteBucketAndObjects(bucket, force)
+			return sc.deleteBucketAndObjects(bucket, force, jobs)
 		},
 	}
-	deleteObjectCmd.Flags().BoolP("force", "", false, "delete Bucket and all Objects")
+	deleteObjectCmd.Flags().BoolP("force", "", false, "delete Bucket and all Object versions, delete markers and MPU")
 	deleteObjectCmd.Flags().StringP("version", "", "", "Object version ID to delete")
 	deleteObjectCmd.Flags().BoolP("prefix", "x", false, "delete Objects start with specified prefix")
+	deleteObjectCmd.Flags().IntP("jobs", "j", 4, "number of parallel DeleteObjects batches")
 	rootCmd.AddCommand(deleteObjectCmd)
 
+	syncCmd := &cobra.Command{
+		Use:   "sync <source> <destination>",
+		Short: "sync local dir and Bucket/prefix, or between Buckets",
+		Long: `sync new or changed files/Objects from source to destination usage:
+* sync local dir to Bucket/prefix, upload files missing in Bucket, different in size or modified after the Object
+	s3cli sync ./dir bucket/prefix
+* sync local dir to Bucket/prefix, compare MD5 of local file with Object ETag
+	s3cli sync ./dir bucket/prefix --checksum
+* sync Bucket/prefix to local dir, download Objects missing in local dir, different in size or mtime,
+  and set the mtime of downloaded file to the Object LastModified
+	s3cli sync bucket/prefix ./dir
+* sync Bucket/prefix to Bucket2/prefix2 server-side, copy Objects missing in destination,
+  different in size or modified after the destination Object(different in ETag if --checksum)
+	s3cli sync bucket/prefix bucket2/prefix2
+* mirror local dir to Bucket/prefix, delete Objects not exist in local dir(at most 100, default 1000)
+	s3cli sync ./dir bucket/prefix --delete --max-delete 100
+* mirror without delete limit
+	s3cli sync ./dir bucket/prefix --delete --max-delete 0
+* list Objects/files to delete without deleting
+	s3cli sync ./dir bucket/prefix --delete --dry-run
+
+* local path must be absolute, start with . or exists, otherwise it is treated as bucket[/prefix]`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			if sc.mpuThreshold, err = parseSize(cmd.Flag("mpu-threshold").Value.String()); err != nil {
+				return err
+			}
+			if sc.partSize, err = parseSize(cmd.Flag("part-size").Value.String()); err != nil {
+				return err
+			}
+			if sc.concurrency, err = cmd.Flags().GetInt("concurrency"); err != nil {
+				return err
+			}
+			opt := syncOptions{
+				checksum: cmd.Flag("checksum").Changed,
+				delete:   cmd.Flag("delete").Changed,
+				dryRun:   cmd.Flag("dry-run").Changed,
+			}
+			if opt.jobs, err = cmd.Flags().GetInt("jobs"); err != nil {
+				return err
+			}
+			if opt.maxDelete, err = cmd.Flags().GetInt("max-delete"); err != nil {
+				return err
+			}
+			srcLocal, dstLocal := isLocalPath(args[0]), isLocalPath(args[1])
+			if srcLocal && !dstLocal {
+				bucket, prefix := splitBucketPrefix(args[1])
+				return sc.syncLocalToBucket(args[0], bucket, prefix, opt)
+			} else if !srcLocal && dstLocal {
+				bucket, prefix := splitBucketPrefix(args[0])
+				return sc.syncBucketToLocal(bucket, prefix, args[1], opt)
+			} else if !srcLocal && !dstLocal {
+				srcBucket, srcPrefix := splitBucketPrefix(args[0])
+				bucket, prefix := splitBucketPrefix(args[1])
+				return sc.syncBucketToBucket(srcBucket, srcPrefix, bucket, prefix, opt)
+			}
+			return fmt.Errorf("unsupported sync from %s to %s", args[0], args[1])
+		},
+	}
+	syncCmd.Flags().BoolP("checksum", "", false, "compare MD5 with ETag instead of size and mtime")
+	syncCmd.Flags().IntP("jobs", "j", 4, "number of parallel file/Object transfers")
+	syncCmd.Flags().BoolP("delete", "", false, "delete destination files/Objects not exist in source")
+	syncCmd.Flags().IntP("max-delete", "", 1000, "refuse to delete more than max-delete files/Objects(0 means no limit)")
+	syncCmd.Flags().BoolP("dry-run", "", false, "list files/Objects to delete without deleting")
+	syncCmd.Flags().StringP("mpu-threshold", "", "64M", "put file by MPU if file size exceeds threshold(0 to disable MPU), MPU reads the whole file once before upload to save its SHA-256")
+	syncCmd.Flags().StringP("part-size", "", "16M", "MPU or ranged GET part size")
+	syncCmd.Flags().IntP("concurrency", "c", 4, "number of parallel MPU parts or ranged GET")
+	rootCmd.AddCommand(syncCmd)
+
 	// MPU sub-command
 	mpuCmd := &cobra.Command{
 		Use:   "mpu",
@@ -746,17 +1135,50 @@ Credential EnvVar:
 	mpuCmd.AddCommand(mpuCreateCmd)
 
 	mpuUploadCmd := &cobra.Command{
-		Use:   "upload <bucket/key> <UploadId> <part-num:file>",
+		Use:   "upload <bucket/key> <UploadId> <part-num:file ...|file>",
 		Short: "upload MPU part(s)",
 		Long: `upload a mutiPartUpload part usage:
 * upload MPU part1
 	s3cli mpu upload bucket/key UploadId 1:localfile1
 * upload MPU part2
 	s3cli mpu upload bucket/key UploadId 2:localfile2
-* upload MPU part1 and part2
-	s3cli mpu upload bucket/key UploadId 1:localfile1 2:localfile2`,
+* upload MPU part1 and part2, print their ETags in part number order
+  (print part-number and ETag of the uploaded parts if some parts failed)
+	s3cli mpu upload bucket/key UploadId 1:localfile1 2:localfile2
+* upload MPU parts 8 in parallel, retry a failed part 5 times, and complete the MPU with the printed ETags
+	s3cli mpu complete bucket/key UploadId $(s3cli mpu upload bucket/key UploadId 1:part1 2:part2 3:part3 --jobs 8 --retries 5)
+* upload a large file split into 64M parts
+	s3cli mpu upload bucket/key UploadId /path/to/large-file --part-size 64M
+* re-upload part 3 and parts 7 to 9 of a large file split into 64M parts
+	s3cli mpu upload bucket/key UploadId /path/to/large-file --part-size 64M --parts 3,7-9`,
 		Args: cobra.MinimumNArgs(3),
 		RunE: func(cmd *cobra.Command, args []string) error {
+			jobs, err := cmd.Flags().GetInt("jobs")
+			if err != nil {
+				return err
+			}
+			retries, err := cmd.Flags().GetInt("retries")
+			if err != nil {
+				return err
+			}
+			bucket, key := splitBucketObject(args[0])
+			if len(args) == 3 && !isPartFile(args[2]) { // split a single file
+				partSize, err := parseSize(cmd.Flag("part-size").Value.String())
+				if err != nil {
+					return err
+				}
+				parts, err := parsePartNumbers(cmd.Flag("parts").Value.String())
+				if err != nil {
+					return err
+				}
+				sc.startProgress()
+				defer sc.stopProgress()
+				return sc.mpuUploadFile(bucket, key, args[1], args[2], partSize, parts, jobs, retries)
+			}
+			if cmd.Flag("parts").Changed {
+				return fmt.Errorf("--parts only works with a single file")
+			}
+
 			files := map[int64]string{}
 			for _, v := range args[2:] {
 				i := strings.Index(v, ":")
@@ -770,31 +1192,61 @@ Credential EnvVar:
 				files[part] = v[i+1:]
 			}
 
-			bucket, key := splitBucketObject(args[0])
-			return sc.mpuUpload(bucket, key, args[1], files)
+			sc.startProgress()
+			defer sc.stopProgress()
+			return sc.mpuUpload(bucket, key, args[1], files, jobs, retries)
 		},
 	}
+	mpuUploadCmd.Flags().IntP("jobs", "j", 4, "number of parallel part uploads")
+	mpuUploadCmd.Flags().IntP("retries", "", 3, "number of retries of a part failed with a temporary error(network, throttle, 5xx), after the SDK retries")
+	mpuUploadCmd.Flags().StringP("part-size", "", "16M", "part size to split a single file(at least 5M)")
+	mpuUploadCmd.Flags().StringP("parts", "", "", "part numbers of a single file to upload(1,3,5-7), default all parts")
+	mpuUploadCmd.Flags().StringP("progress", "", progressAuto, "show progress to stderr: auto(if stdout is a terminal), json or none")
 	mpuCmd.AddCommand(mpuUploadCmd)
 
 	mpuAbortCmd := &cobra.Command{
-		Use:   "abort <bucket/key> <UploadId>",
+		Use:   "abort <bucket/key> <UploadId> | abort <bucket[/prefix]> --older-than <age>",
 		Short: "abort a MPU request",
 		Long: `abort a mutiPartUpload request usage:
 * abort a mpu request
-	s3cli mpu abort bucket/key UploadId`,
-		Args: cobra.ExactArgs(2),
+	s3cli mpu abort bucket/key UploadId
+* list mpu requests with prefix initiated more than 72 hours ago
+	s3cli mpu abort bucket/prefix --older-than 72h --dry-run
+* abort all mpu requests in bucket initiated more than 72 hours ago
+	s3cli mpu abort bucket --older-than 72h`,
+		Args: cobra.RangeArgs(1, 2),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			bucket, key := splitBucketObject(args[0])
+			if cmd.Flag("older-than").Changed {
+				if len(args) != 1 {
+					return fmt.Errorf("--older-than requires <bucket[/prefix]> only")
+				}
+				age, err := time.ParseDuration(cmd.Flag("older-than").Value.String())
+				if err != nil {
+					return fmt.Errorf("invalid older-than: %w", err)
+				}
+				jobs, err := cmd.Flags().GetInt("jobs")
+				if err != nil {
+					return err
+				}
+				return sc.mpuAbortOlder(bucket, key, age, jobs, cmd.Flag("dry-run").Changed)
+			}
+			if len(args) != 2 {
+				return fmt.Errorf("UploadId is required without --older-than")
+			}
 			return sc.mpuAbort(bucket, key, args[1])
 		},
 	}
+	mpuAbortCmd.Flags().StringP("older-than", "", "", "abort all mpu requests initiated more than the age(72h) ago")
+	mpuAbortCmd.Flags().BoolP("dry-run", "", false, "list mpu requests to abort without aborting")
+	mpuAbortCmd.Flags().IntP("jobs", "j", 4, "number of parallel aborts with --older-than")
 	mpuCmd.AddCommand(mpuAbortCmd)
 
 	mpuListCmd := &cobra.Command{
 		Use:     "list <bucket/prefix>",
 		Aliases: []string{"ls"},
 		Short:   "list MPU",
-		Long: `list mutiPartUploads usage:
+		Long: `list all mutiPartUploads(initiated time, age, key and UploadId) usage:
 * list MPU
 	s3cli mpu ls bucket/prefix`,
 		Args: cobra.ExactArgs(1),
@@ -805,15 +1257,40 @@ Credential EnvVar:
 	}
 	mpuCmd.AddCommand(mpuListCmd)
 
+	mpuPartsCmd := &cobra.Command{
+		Use:   "parts <bucket/key> <UploadId>",
+		Short: "list MPU parts",
+		Long: `list uploaded parts(part-number size ETag) of a mutiPartUpload usage:
+* list MPU parts
+	s3cli mpu parts bucket/key UploadId`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			bucket, key := splitBucketObject(args[0])
+			return sc.mpuParts(bucket, key, args[1])
+		},
+	}
+	mpuCmd.AddCommand(mpuPartsCmd)
+
 	mpuCompleteCmd := &cobra.Command{
-		Use:   "complete <bucket/key> <UploadId> <part-etag> [<part-etag> ...]",
+		Use:   "complete <bucket/key> <UploadId> [<part-etag> ...]",
 		Short: "complete a MPU request",
 		Long: `complete a mutiPartUpload request usage:
-* complete a MPU request
-	s3cli mpu complete bucket/key UploadId etag01 etag02 etag03`,
-		Args: cobra.MinimumNArgs(3),
+* complete a MPU request, the ETags are part 1, 2, 3
+	s3cli mpu complete bucket/key UploadId etag01 etag02 etag03
+* complete a MPU request with all uploaded parts(listed by mpu parts)
+	s3cli mpu complete bucket/key UploadId --auto`,
+		Args: cobra.MinimumNArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			bucket, key := splitBucketObject(args[0])
+			if cmd.Flag("auto").Changed {
+				if len(args) > 2 {
+					return fmt.Errorf("part-etag is not allowed with --auto")
+				}
+				return sc.mpuCompleteAuto(bucket, key, args[1])
+			}
+			if len(args) < 3 {
+				return fmt.Errorf("part-etag is required without --auto")
+			}
 			etags := make([]string, len(args)-2)
 			for i := range etags {
 				etags[i] = args[i+2]
@@ -821,6 +1298,7 @@ Credential EnvVar:
 			return sc.mpuComplete(bucket, key, args[1], etags)
 		},
 	}
+	mpuCompleteCmd.Flags().BoolP("auto", "", false, "complete with all uploaded parts listed by ListParts")
 	mpuCmd.AddCommand(mpuCompleteCmd)
 
 	if err := rootCmd.Execute(); err != nil {
@@ -6,6 +6,7 @@ import (
 	mand "math/rand"
 	"net/http/httptest"
 	"os"
+	"reflect"
 	"testing"
 	"time"
 
@@ -35,6 +36,7 @@ func setEnv() error {
 
 func TestMain(m *testing.M) {
 	mand.Seed(time.Now().UTC().UnixNano())
+	minPartSize = 100 // MPU tests use small parts
 	// init fake s3
 	s3Backend = s3mem.New()
 	faker := gofakes3.New(s3Backend)
@@ -78,3 +80,125 @@ func Test_splitBucketObject(t *testing.T) {
 		}
 	}
 }
+
+func Test_splitBucketPrefix(t *testing.T) {
+	cases := map[string][2]string{
+		"b":          {"b", ""},
+		"b/":         {"b", ""},
+		"b/dir":      {"b", "dir/"},
+		"b/dir/":     {"b", "dir/"},
+		"b/dir/sub2": {"b", "dir/sub2/"},
+	}
+	for k, v := range cases {
+		bucket, prefix := splitBucketPrefix(k)
+		if bucket != v[0] || prefix != v[1] {
+			t.Errorf("expect: %s, got: %s, %s", v, bucket, prefix)
+		}
+	}
+}
+
+func Test_parseSize(t *testing.T) {
+	cases := map[string]int64{
+		"0":     0,
+		"1024":  1024,
+		"64K":   64 << 10,
+		"16m":   16 << 20,
+		"16MB":  16 << 20,
+		"16MiB": 16 << 20,
+		"2G":    2 << 30,
+		"1T":    1 << 40,
+	}
+	for k, v := range cases {
+		size, err := parseSize(k)
+		if err != nil {
+			t.Errorf("parseSize %s failed: %s", k, err)
+		} else if size != v {
+			t.Errorf("parseSize %s expect: %d, got: %d", k, v, size)
+		}
+	}
+	for _, v := range []string{"", "M", "-1", "1X"} {
+		if _, err := parseSize(v); err == nil {
+			t.Errorf("parseSize %s expect error", v)
+		}
+	}
+}
+
+func Test_isLocalPath(t *testing.T) {
+	cases := map[string]bool{
+		"":                false,
+		".":               true,
+		"./dir":           true,
+		"../dir":          true,
+		"/tmp":            true,
+		"bucket":          false,
+		"bucket/prefix/":  false,
+		"main_test.go":    true,
+		"no-such-dir/abc": false,
+	}
+	for k, v := range cases {
+		if got := isLocalPath(k); got != v {
+			t.Errorf("isLocalPath %s expect: %v, got: %v", k, v, got)
+		}
+	}
+}
+
+func Test_isPartFile(t *testing.T) {
+	cases := map[string]bool{
+		"1:file":      true,
+		"10:/tmp/a:b": true,
+		"file":        false,
+		":file":       false,
+		"c:/tmp/file": false,
+		"/tmp/1:file": false,
+	}
+	for k, v := range cases {
+		if got := isPartFile(k); got != v {
+			t.Errorf("isPartFile(%s) expect: %v, got: %v", k, v, got)
+		}
+	}
+}
+
+func Test_parsePartNumbers(t *testing.T) {
+	cases := map[string][]int64{
+		"":          {},
+		"3":         {3},
+		"1,3,5-7":   {1, 3, 5, 6, 7},
+		"7-9, 3, 8": {3, 7, 8, 9},
+	}
+	for k, v := range cases {
+		got, err := parsePartNumbers(k)
+		if err != nil || !reflect.DeepEqual(got, v) {
+			t.Errorf("parsePartNumbers(%s) expect: %v, got: %v, %v", k, v, got, err)
+		}
+	}
+	for _, k := range []string{"0", "a", "3-1", "1-", "10001"} {
+		if _, err := parsePartNumbers(k); err == nil {
+			t.Errorf("parsePartNumbers(%s) should fail", k)
+		}
+	}
+}
+
+func Test_newS3Client(t *testing.T) {
+	sc := s3cliTest
+	client, err := newS3Client(&sc)
+	if err != nil {
+		t.Fatalf("newS3Client failed: %s", err)
+	}
+	switch tr := client.Config.HTTPClient.Transport.(type) {
+	case *progressTransport, *limitTransport:
+		t.Errorf("newS3Client should keep the session transport, got %T", tr)
+	}
+
+	sc.limitRate = 1024
+	sc.progress = &progress{}
+	if client, err = newS3Client(&sc); err != nil {
+		t.Fatalf("newS3Client failed: %s", err)
+	}
+	pt, ok := client.Config.HTTPClient.Transport.(*progressTransport)
+	if !ok {
+		t.Fatalf("newS3Client expect progressTransport, got %T", client.Config.HTTPClient.Transport)
+	}
+	if _, ok := pt.base.(*limitTransport); !ok {
+		t.Errorf("newS3Client expect limitTransport, got %T", pt.base)
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+const (
+	progressAuto = "auto" // show progress if stdout is a terminal
+	progressJSON = "json" // emit newline-delimited JSON progress events
+	progressNone = "none" // never show progress
+)
+
+// progressInterval is the interval between progress reports
+const progressInterval = 500 * time.Millisecond
+
+// progressKey is the context key of the progress tracking a request
+type progressKey struct{}
+
+// progress track the bytes transferred by all requests of a command,
+// reported to stderr to keep stdout for the command output(ETags, summary...)
+type progress struct {
+	bytes int64 // bytes transferred, accessed atomically
+	total int64 // bytes to transfer(0 if unknown), accessed atomically
+
+	parent *progress // the progress of command if this is an attempt
+
+	json  bool
+	out   io.Writer
+	begin time.Time
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// progressEvent is a JSON progress event
+type progressEvent struct {
+	Bytes   int64   `json:"bytes"`
+	Total   int64   `json:"total,omitempty"`
+	Rate    int64   `json:"rate"`          // bytes per second
+	ETA     float64 `json:"eta,omitempty"` // seconds
+	Elapsed float64 `json:"elapsed"`       // seconds
+	Done    bool    `json:"done"`
+}
+
+// newProgress create a progress by mode, return nil if progress is disabled
+func newProgress(mode string) (*progress, error) {
+	switch mode {
+	case progressNone:
+		return nil, nil
+	case progressAuto:
+		// progress is written to stderr, but not shown if stdout is redirected
+		fi, err := os.Stdout.Stat()
+		if err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+			return nil, nil
+		}
+	case progressJSON:
+	default:
+		return nil, fmt.Errorf("invalid progress %q, should be %s, %s or %s", mode, progressAuto, progressJSON, progressNone)
+	}
+	return &progress{
+		json: mode == progressJSON,
+		out:  os.Stderr,
+		done: make(chan struct{}),
+	}, nil
+}
+
+// start report progress every interval until stop
+func (p *progress) start(interval time.Duration) {
+	if p == nil {
+		return
+	}
+	p.begin = time.Now()
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.report(false)
+			case <-p.done:
+				p.report(true)
+				return
+			}
+		}
+	}()
+}
+
+// stop report the final progress
+func (p *progress) stop() {
+	if p == nil {
+		return
+	}
+	close(p.done)
+	p.wg.Wait()
+}
+
+// addTotal add n bytes to transfer
+func (p *progress) addTotal(n int64) {
+	if p != nil {
+		atomic.AddInt64(&p.total, n)
+	}
+}
+
+// add add n bytes transferred
+func (p *progress) add(n int64) {
+	for ; p != nil; p = p.parent {
+		atomic.AddInt64(&p.bytes, n)
+	}
+}
+
+// attempt return a progress of a request attempt, its bytes are added to p
+func (p *progress) attempt() *progress {
+	if p == nil {
+		return nil
+	}
+	return &progress{parent: p}
+}
+
+// reset remove the bytes of a failed attempt from its parent progress
+func (p *progress) reset() {
+	if p != nil {
+		p.parent.add(-atomic.SwapInt64(&p.bytes, 0))
+	}
+}
+
+func (p *progress) event(done bool) progressEvent {
+	e := progressEvent{
+		Bytes:   atomic.LoadInt64(&p.bytes),
+		Total:   atomic.LoadInt64(&p.total),
+		Elapsed: time.Since(p.begin).Seconds(),
+		Done:    done,
+	}
+	if e.Elapsed > 0 {
+		e.Rate = int64(float64(e.Bytes) / e.Elapsed)
+	}
+	if !done && e.Rate > 0 && e.Total > e.Bytes {
+		e.ETA = float64(e.Total-e.Bytes) / float64(e.Rate)
+	}
+	return e
+}
+
+func (p *progress) report(done bool) {
+	e := p.event(done)
+	if p.json {
+		data, _ := json.Marshal(e)
+		fmt.Fprintf(p.out, "%s\n", data)
+		return
+	}
+	// rewrite the current terminal line
+	line := fmt.Sprintf("\r\033[K%s", formatBytes(e.Bytes))
+	if e.Total > 0 {
+		line += fmt.Sprintf(" / %s %3d%%", formatBytes(e.Total), e.Bytes*100/e.Total)
+	}
+	line += fmt.Sprintf("  %s/s", formatBytes(e.Rate))
+	if e.ETA > 0 {
+		line += fmt.Sprintf("  ETA %s", time.Duration(e.ETA*float64(time.Second)).Round(time.Second))
+	}
+	if done {
+		line += "\n"
+	}
+	fmt.Fprint(p.out, line)
+}
+
+// formatBytes format n bytes in human readable units(KiB, MiB, ...)
+func formatBytes(n int64) string {
+	const unit = 1 << 10
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// transferContext return the context of a transfer request, tracked by sc.progress
+func (sc *S3Cli) transferContext() aws.Context {
+	if sc.progress == nil {
+		return aws.BackgroundContext()
+	}
+	return context.WithValue(aws.BackgroundContext(), progressKey{}, sc.progress)
+}
+
+// countingReadCloser add the bytes read from an io.ReadCloser to a progress
+type countingReadCloser struct {
+	rc io.ReadCloser
+	p  *progress
+}
+
+func (cr *countingReadCloser) Read(b []byte) (int, error) {
+	n, err := cr.rc.Read(b)
+	cr.p.add(int64(n))
+	return n, err
+}
+
+func (cr *countingReadCloser) Close() error {
+	return cr.rc.Close()
+}
+
+// progressTransport count the request and response bodies of requests tracked by a progress
+type progressTransport struct {
+	base http.RoundTripper
+}
+
+func (t *progressTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	p, _ := req.Context().Value(progressKey{}).(*progress)
+	if p == nil {
+		return t.base.RoundTrip(req)
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		r := req.Clone(req.Context())
+		r.Body = &countingReadCloser{rc: req.Body, p: p}
+		req = r
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Body != nil && resp.Body != http.NoBody {
+		resp.Body = &countingReadCloser{rc: resp.Body, p: p}
+	}
+	return resp, nil
+}
+
+// startProgress start reporting transfer progress, the progress is created with S3 client
+func (sc *S3Cli) startProgress() {
+	sc.progress.start(progressInterval)
+}
+
+// stopProgress report the final transfer progress
+func (sc *S3Cli) stopProgress() {
+	sc.progress.stop()
+}
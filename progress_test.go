@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func Test_formatBytes(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0B"},
+		{1023, "1023B"},
+		{1024, "1.0KiB"},
+		{1536, "1.5KiB"},
+		{20 << 20, "20.0MiB"},
+		{3 << 30, "3.0GiB"},
+	}
+	for _, tt := range tests {
+		if got := formatBytes(tt.n); got != tt.want {
+			t.Errorf("formatBytes(%d) = %s, want %s", tt.n, got, tt.want)
+		}
+	}
+}
+
+func Test_progress(t *testing.T) {
+	if _, err := newProgress("bar"); err == nil {
+		t.Errorf("newProgress invalid mode should fail")
+	}
+	if p, err := newProgress(progressNone); p != nil || err != nil {
+		t.Errorf("newProgress none should be disabled, got %v, %v", p, err)
+	}
+
+	dir := t.TempDir()
+	filename, data := writeRandomFile(t, dir, "file", 1000)
+
+	for _, tt := range []struct {
+		name string
+		fn   func(sc *S3Cli) error
+	}{
+		{"put", func(sc *S3Cli) error { return sc.putFile(testBucketName, "testProgress", filename) }},
+		{"mpu", func(sc *S3Cli) error {
+			sc.mpuThreshold = 300
+			sc.partSize = 300
+			sc.concurrency = 2
+			return sc.putFile(testBucketName, "testProgress", filename)
+		}},
+		{"get", func(sc *S3Cli) error {
+			return sc.downloadObject(testBucketName, "testProgress", "", filepath.Join(dir, "file.get"))
+		}},
+	} {
+		sc := s3cliTest
+		var out bytes.Buffer
+		p, err := newProgress(progressJSON)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.out = &out
+		sc.progress = p
+		if sc.Client, err = newS3Client(&sc); err != nil {
+			t.Fatal(err)
+		}
+		p.start(time.Hour)
+		if err := tt.fn(&sc); err != nil {
+			t.Errorf("%s with progress failed: %s", tt.name, err)
+		}
+		p.stop()
+
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		var e progressEvent
+		if err := json.Unmarshal([]byte(lines[len(lines)-1]), &e); err != nil {
+			t.Errorf("%s progress invalid event %q: %s", tt.name, lines[len(lines)-1], err)
+			continue
+		}
+		if !e.Done || e.Total != int64(len(data)) || e.Bytes < e.Total {
+			t.Errorf("%s progress got %+v, want done with %d bytes", tt.name, e, len(data))
+		}
+	}
+}
+
+// captureOutput return what fn write to stdout and stderr
+func captureOutput(t *testing.T, fn func()) (string, string) {
+	var outputs [2]bytes.Buffer
+	var wg sync.WaitGroup
+	std := [2]**os.File{&os.Stdout, &os.Stderr}
+	saved := [2]*os.File{os.Stdout, os.Stderr}
+	writers := [2]*os.File{}
+	for i := range std {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		writers[i] = w
+		*std[i] = w
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			io.Copy(&outputs[i], r)
+			r.Close()
+		}(i)
+	}
+	fn()
+	for i := range std {
+		*std[i] = saved[i]
+		writers[i].Close()
+	}
+	wg.Wait()
+	return outputs[0].String(), outputs[1].String()
+}
+
+func Test_mpuUploadProgress(t *testing.T) {
+	key := "testMpuUploadProgress"
+	dir := t.TempDir()
+	files := map[int64]string{}
+	for i := int64(1); i <= 3; i++ {
+		files[i] = filepath.Join(dir, fmt.Sprintf("part%d", i))
+		if err := ioutil.WriteFile(files[i], testObjectContent, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	createResp, err := s3cliTest.Client.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+		Bucket: aws.String(testBucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		t.Fatalf("CreateMultipartUpload failed: %s", err)
+	}
+
+	sc := s3cliTest
+	stdout, stderr := captureOutput(t, func() {
+		if sc.progress, err = newProgress(progressJSON); err != nil {
+			t.Errorf("newProgress failed: %s", err)
+			return
+		}
+		if sc.Client, err = newS3Client(&sc); err != nil {
+			t.Errorf("newS3Client failed: %s", err)
+			return
+		}
+		sc.startProgress()
+		if err := sc.mpuUpload(testBucketName, key, aws.StringValue(createResp.UploadId), files, 2, 0); err != nil {
+			t.Errorf("mpuUpload failed: %s", err)
+		}
+		sc.stopProgress()
+	})
+
+	// stdout is the ETags only, stderr is valid NDJSON
+	if etags := strings.Fields(stdout); len(etags) != len(files) {
+		t.Errorf("mpuUpload stdout expect %d ETags, got %q", len(files), stdout)
+	}
+	lines := strings.Split(strings.TrimSpace(stderr), "\n")
+	for _, line := range lines {
+		var e progressEvent
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Errorf("mpuUpload progress invalid event %q: %s", line, err)
+		}
+	}
+	var e progressEvent
+	json.Unmarshal([]byte(lines[len(lines)-1]), &e)
+	if !e.Done || e.Total != int64(len(files)*len(testObjectContent)) {
+		t.Errorf("mpuUpload progress got %+v, want done with %d bytes", e, len(files)*len(testObjectContent))
+	}
+}
+
+func Test_mpuUploadPartsRetryProgress(t *testing.T) {
+	defer func(d time.Duration) { retryBackoff = d }(retryBackoff)
+	retryBackoff = time.Millisecond
+	temporary := awserr.NewRequestFailure(awserr.New("InternalError", "fail", nil), http.StatusInternalServerError, "")
+
+	sc := s3cliTest
+	sc.progress = &progress{}
+	var mu sync.Mutex
+	calls := map[int64]int{}
+	stdout, _ := captureOutput(t, func() {
+		err := sc.mpuUploadParts([]int64{1, 2, 3}, 2, 1, func(sc *S3Cli, num int64) (string, error) {
+			sc.progress.add(100)
+			mu.Lock()
+			defer mu.Unlock()
+			calls[num]++
+			if num == 2 || calls[num] == 1 {
+				return "", temporary // part 2 always fails, others succeed at retry
+			}
+			return fmt.Sprintf("etag%d", num), nil
+		})
+		if err == nil {
+			t.Errorf("mpuUploadParts expect part 2 failed")
+		}
+	})
+	if stdout != "1 etag1\n3 etag3\n" {
+		t.Errorf("mpuUploadParts expect uploaded parts printed, got %q", stdout)
+	}
+	if sc.progress.bytes != 200 {
+		t.Errorf("mpuUploadParts progress expect 200 bytes of uploaded parts, got %d", sc.progress.bytes)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// limitChunk is the max bytes read at once by a rate limited reader
+const limitChunk = 32 << 10
+
+// rateLimiter limit the bytes per second shared by all readers
+type rateLimiter struct {
+	mu   sync.Mutex
+	rate float64   // bytes per second
+	next time.Time // the time all reserved bytes are transferred
+}
+
+func newRateLimiter(rate int64) *rateLimiter {
+	return &rateLimiter{rate: float64(rate)}
+}
+
+// wait reserve n bytes and block until they can be transferred
+func (l *rateLimiter) wait(n int) {
+	if n <= 0 {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	at := l.next
+	l.next = l.next.Add(time.Duration(float64(n) / l.rate * float64(time.Second)))
+	l.mu.Unlock()
+	time.Sleep(at.Sub(now))
+}
+
+// limitedReadCloser throttle an io.ReadCloser by a rateLimiter
+type limitedReadCloser struct {
+	rc      io.ReadCloser
+	limiter *rateLimiter
+}
+
+func (lr *limitedReadCloser) Read(p []byte) (int, error) {
+	if len(p) > limitChunk {
+		p = p[:limitChunk]
+	}
+	n, err := lr.rc.Read(p)
+	lr.limiter.wait(n)
+	return n, err
+}
+
+func (lr *limitedReadCloser) Close() error {
+	return lr.rc.Close()
+}
+
+// limitTransport throttle all request and response bodies by a shared rateLimiter
+type limitTransport struct {
+	base    http.RoundTripper
+	limiter *rateLimiter
+}
+
+func (t *limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil && req.Body != http.NoBody {
+		r := req.Clone(req.Context())
+		r.Body = &limitedReadCloser{rc: req.Body, limiter: t.limiter}
+		req = r
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Body != nil && resp.Body != http.NoBody {
+		resp.Body = &limitedReadCloser{rc: resp.Body, limiter: t.limiter}
+	}
+	return resp, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_rateLimiter(t *testing.T) {
+	limiter := newRateLimiter(256 << 10)
+	data := make([]byte, 96<<10)
+	r := &limitedReadCloser{rc: ioutil.NopCloser(bytes.NewReader(data)), limiter: limiter}
+	start := time.Now()
+	n, err := io.Copy(ioutil.Discard, r)
+	if err != nil || n != int64(len(data)) {
+		t.Errorf("limitedReadCloser read %d bytes, %v", n, err)
+	}
+	// 3 chunks of 32K at 256K/s, the last chunk waits for 250ms
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("limitedReadCloser not limited, elapsed %s", elapsed)
+	}
+}
+
+func Test_limitTransport(t *testing.T) {
+	data := make([]byte, 96<<10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(ioutil.Discard, r.Body)
+		w.Write(data)
+	}))
+	defer ts.Close()
+
+	client := &http.Client{
+		Transport: &limitTransport{
+			base:    http.DefaultTransport,
+			limiter: newRateLimiter(512 << 10),
+		},
+	}
+	start := time.Now()
+	resp, err := client.Post(ts.URL, "application/octet-stream", bytes.NewReader(data))
+	if err != nil {
+		t.Errorf("limitTransport POST failed: %s", err)
+		return
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(ioutil.Discard, resp.Body); err != nil {
+		t.Errorf("limitTransport read body failed: %s", err)
+	}
+	// 6 chunks of 32K(upload and download share the limit) at 512K/s
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Errorf("limitTransport not limited, elapsed %s", elapsed)
+	}
+}
@@ -1,20 +1,28 @@
 package main
 
 import (
+	"bytes"
 	"crypto/hmac"
 	"crypto/sha1"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/url"
 	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"text/tabwriter"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 
 	"github.com/aws/aws-sdk-go/service/s3"
 )
@@ -31,6 +39,71 @@ type S3Cli struct {
 	verbose    bool
 	debug      bool
 	Client     *s3.S3 // manual init this field
+
+	mpuThreshold int64     // put file by MPU if file size exceeds mpuThreshold
+	partSize     int64     // MPU part size
+	concurrency  int       // number of parallel MPU parts
+	resume       bool      // resume upload/download from checkpoint file
+	limitRate    int64     // max bytes per second of all transfers(0 means no limit)
+	progress     *progress // track bytes transferred(nil means no progress)
+}
+
+const (
+	// maxPartNum is the maximum number of parts in a MPU
+	maxPartNum = 10000
+	// maxCopySize is the maximum Object size of a single CopyObject
+	maxCopySize = 5 << 30
+)
+
+// minPartSize is the minimum size of a MPU part except the last one
+var minPartSize int64 = 5 << 20
+
+// checkPartSize check if partSize is valid for MPU
+func checkPartSize(partSize int64) error {
+	if partSize < minPartSize {
+		return fmt.Errorf("invalid part size: %d, should be at least %d", partSize, minPartSize)
+	}
+	return nil
+}
+
+// runJobs call fn(0..n-1) with at most concurrency goroutines,
+// stop dispatching new jobs after the first error and return it.
+func runJobs(n int64, concurrency int, fn func(i int64) error) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return firstErr != nil
+	}
+	jobs := make(chan int64)
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if err := fn(i); err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for i := int64(0); i < n && !failed(); i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return firstErr
 }
 
 // presignV2 presigne URL with escaped key(Object name).
@@ -350,8 +423,17 @@ func (sc *S3Cli) putObject(bucket, key string, r io.ReadSeeker) error {
 	}
 	if !reflect.ValueOf(r).IsNil() {
 		putObjectInput.Body = r
+		if !sc.presign {
+			// let server reject a corrupted body
+			sum, err := contentMD5(r)
+			if err != nil {
+				return err
+			}
+			putObjectInput.ContentMD5 = aws.String(sum)
+		}
 	}
 	req, resp := sc.Client.PutObjectRequest(putObjectInput)
+	req.SetContext(sc.transferContext())
 
 	if sc.presign {
 		s, err := req.Presign(sc.presignExp)
@@ -371,6 +453,321 @@ func (sc *S3Cli) putObject(bucket, key string, r io.ReadSeeker) error {
 	return nil
 }
 
+// putFile upload a local file, use MPU if file size exceeds mpuThreshold
+func (sc *S3Cli) putFile(bucket, key, filename string) error {
+	fd, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	if sc.presign {
+		return sc.putObject(bucket, key, fd)
+	}
+	fi, err := fd.Stat()
+	if err != nil {
+		return err
+	}
+	sc.progress.addTotal(fi.Size())
+	if sc.mpuThreshold <= 0 || fi.Size() <= sc.mpuThreshold {
+		return sc.putObject(bucket, key, fd)
+	}
+
+	if !sc.resume {
+		return sc.mpuPutObject(bucket, key, fd, fi.Size(), nil)
+	}
+
+	// MPU progress is saved in checkpoint file to continue an interrupted upload
+	cpFile := filename + mpuCheckpointSuffix
+	cp, err := loadMpuCheckpoint(cpFile)
+	if err != nil {
+		return err
+	}
+	if cp == nil {
+		cp = &mpuCheckpoint{
+			path:    cpFile,
+			Bucket:  bucket,
+			Key:     key,
+			Size:    fi.Size(),
+			ModTime: fi.ModTime(),
+			Parts:   map[int64]string{},
+		}
+	} else if !cp.match(bucket, key, fi) {
+		return fmt.Errorf("checkpoint %s not match %s(%s/%s), remove it to restart", cpFile, filename, bucket, key)
+	}
+	return sc.mpuPutObject(bucket, key, fd, fi.Size(), cp)
+}
+
+// listLocalFiles return all regular files in dir, keyed by slash separated relative path
+func listLocalFiles(dir string) (map[string]os.FileInfo, error) {
+	files := map[string]os.FileInfo{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() ||
+			strings.HasSuffix(path, mpuCheckpointSuffix) || strings.HasSuffix(path, getCheckpointSuffix) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = info
+		return nil
+	})
+	return files, err
+}
+
+// printSummary print the result of each item and a summary line,
+// return error if any item failed
+func printSummary(items []string, errs []error, done string) error {
+	var failed int
+	for i, err := range errs {
+		if err != nil {
+			failed++
+			fmt.Printf("failed:  %s, %s\n", items[i], err)
+		} else {
+			fmt.Printf("success: %s\n", items[i])
+		}
+	}
+	fmt.Printf("%d %s, %d failed\n", len(items)-failed, done, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d failed", failed, len(items))
+	}
+	return nil
+}
+
+// putDir upload all files in local dir to bucket/prefix with their relative paths,
+// at most jobs files are uploaded in parallel and a summary is printed at the end
+func (sc *S3Cli) putDir(bucket, prefix, dir string, jobs int) error {
+	files, err := listLocalFiles(dir)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	errs := make([]error, len(names))
+	runJobs(int64(len(names)), jobs, func(i int64) error {
+		errs[i] = sc.putFile(bucket, prefix+names[i], filepath.Join(dir, filepath.FromSlash(names[i])))
+		return nil
+	})
+	return printSummary(names, errs, "files uploaded")
+}
+
+// mpuPutObject upload size bytes of r as a Object by Multi-Part-Upload.
+// Without checkpoint the MPU is aborted if any part failed,
+// with checkpoint the MPU is kept and the completed parts are skipped when resumed.
+func (sc *S3Cli) mpuPutObject(bucket, key string, r io.ReaderAt, size int64, cp *mpuCheckpoint) error {
+	var uid string
+	var md5s []string // Content-MD5 of parts, computed with SHA-256 of a new upload
+	partSize := sc.partSize
+	if cp != nil && cp.UploadID != "" {
+		uid = cp.UploadID
+		partSize = cp.PartSize
+	} else {
+		if err := checkPartSize(partSize); err != nil {
+			return err
+		}
+		if size > partSize*maxPartNum {
+			partSize = (size + maxPartNum - 1) / maxPartNum
+		}
+		// the ETag of MPU Object is not a MD5, save SHA-256 in metadata to verify download.
+		// The MD5 of parts are computed in the same read(a resumed upload skips it)
+		sum, sums, err := partSums(r, size, partSize)
+		if err != nil {
+			return err
+		}
+		md5s = sums
+		createResp, err := sc.createUpload(&s3.CreateMultipartUploadInput{
+			Bucket:   aws.String(bucket),
+			Key:      aws.String(key),
+			Metadata: map[string]*string{sha256MetaKey: aws.String(sum)},
+		})
+		if err != nil {
+			return err
+		}
+		uid = aws.StringValue(createResp.UploadId)
+		if cp != nil {
+			cp.UploadID = uid
+			cp.PartSize = partSize
+			if err := cp.save(); err != nil {
+				return sc.abortUpload(bucket, key, uid, fmt.Errorf("save checkpoint failed: %w", err))
+			}
+		}
+	}
+	partNum := (size + partSize - 1) / partSize
+
+	parts := make([]*s3.CompletedPart, partNum)
+	err := runJobs(partNum, sc.concurrency, func(i int64) error {
+		offset := i * partSize
+		n := partSize
+		if offset+n > size {
+			n = size - offset
+		}
+		if cp != nil {
+			if etag, ok := cp.part(i + 1); ok {
+				sc.progress.addTotal(-n) // uploaded before resume
+				parts[i] = &s3.CompletedPart{
+					PartNumber: aws.Int64(i + 1),
+					ETag:       aws.String(etag),
+				}
+				return nil
+			}
+		}
+		body := io.NewSectionReader(r, offset, n)
+		var etag string
+		var err error
+		if i < int64(len(md5s)) {
+			etag, err = sc.uploadPartMD5(bucket, key, uid, i+1, body, md5s[i])
+		} else {
+			etag, err = sc.uploadPart(bucket, key, uid, i+1, body)
+		}
+		if err != nil {
+			return fmt.Errorf("upload part %d failed: %w", i+1, err)
+		}
+		parts[i] = &s3.CompletedPart{
+			PartNumber: aws.Int64(i + 1),
+			ETag:       aws.String(etag),
+		}
+		if cp != nil {
+			if err := cp.setPart(i+1, etag); err != nil {
+				return fmt.Errorf("save checkpoint failed: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil && cp == nil {
+		return sc.abortUpload(bucket, key, uid, err)
+	}
+	if err == nil {
+		err = sc.completeUpload(bucket, key, uid, parts, sc.verbose)
+	}
+	if err != nil && cp != nil {
+		if isNoSuchUpload(err) {
+			// the recorded MPU is expired or aborted, nothing to resume
+			if rerr := cp.remove(); rerr != nil {
+				return rerr
+			}
+			return fmt.Errorf("%w, MPU %s not exist(expired or aborted), checkpoint %s removed, rerun to restart", err, uid, cp.path)
+		}
+		return fmt.Errorf("%w, progress saved in %s, rerun with --resume to continue", err, cp.path)
+	} else if err != nil {
+		return err
+	}
+	if cp != nil {
+		return cp.remove()
+	}
+	return nil
+}
+
+// isNoSuchUpload check if err is caused by a not exist(expired or aborted) Multi-Part-Upload
+func isNoSuchUpload(err error) bool {
+	var aerr awserr.Error
+	return errors.As(err, &aerr) && aerr.Code() == s3.ErrCodeNoSuchUpload
+}
+
+// putStream upload a stream of unknown length(stdin) as a Object,
+// a stream smaller than partSize is uploaded by a single PutObject,
+// otherwise it is read into buffered parts and uploaded by Multi-Part-Upload
+func (sc *S3Cli) putStream(bucket, key string, r io.Reader) error {
+	partSize := sc.partSize
+	if err := checkPartSize(partSize); err != nil {
+		return err
+	}
+	buf := make([]byte, partSize)
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return sc.putObject(bucket, key, bytes.NewReader(buf[:n]))
+	} else if err != nil {
+		return err
+	}
+
+	createResp, err := sc.createUpload(&s3.CreateMultipartUploadInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return err
+	}
+	uid := aws.StringValue(createResp.UploadId)
+
+	concurrency := sc.concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		parts    []*s3.CompletedPart
+	)
+	setErr := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return firstErr != nil
+	}
+	// at most concurrency parts are uploading while the next part is reading
+	sem := make(chan struct{}, concurrency)
+	for num := int64(1); !failed(); num++ {
+		if num > maxPartNum {
+			setErr(fmt.Errorf("stream exceeds %d parts, increase part size", maxPartNum))
+			break
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(num int64, data []byte) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			etag, err := sc.uploadPart(bucket, key, uid, num, bytes.NewReader(data))
+			if err != nil {
+				setErr(fmt.Errorf("upload part %d failed: %w", num, err))
+				return
+			}
+			mu.Lock()
+			parts = append(parts, &s3.CompletedPart{
+				PartNumber: aws.Int64(num),
+				ETag:       aws.String(etag),
+			})
+			mu.Unlock()
+		}(num, buf)
+
+		if n < len(buf) { // the last part
+			break
+		}
+		buf = make([]byte, partSize)
+		n, err = io.ReadFull(r, buf)
+		if err == io.EOF {
+			break
+		} else if err == io.ErrUnexpectedEOF {
+			buf = buf[:n]
+		} else if err != nil {
+			setErr(fmt.Errorf("read stream failed: %w", err))
+			break
+		}
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return sc.abortUpload(bucket, key, uid, firstErr)
+	}
+	sort.Slice(parts, func(i, j int) bool {
+		return *parts[i].PartNumber < *parts[j].PartNumber
+	})
+	return sc.completeUpload(bucket, key, uid, parts, sc.verbose)
+}
+
 // headObject head a Object
 func (sc *S3Cli) headObject(bucket, key string, mtime, mtimestamp bool) error {
 	req, resp := sc.Client.HeadObjectRequest(&s3.HeadObjectInput{
@@ -623,17 +1020,59 @@ func (sc *S3Cli) listObjectsV2(bucket, prefix, delimiter, marker string, maxkeys
 	return nil
 }
 
-// listObjectVersions list Objects versions in Bucket
-func (sc *S3Cli) listObjectVersions(bucket, prefix string) error {
+// objectVersion is a version or delete marker of an Object
+type objectVersion struct {
+	key          string
+	versionID    string
+	latest       bool
+	deleteMarker bool
+	size         int64
+	lastModified time.Time
+}
+
+// pageVersions merge the versions and delete markers of a ListObjectVersions page,
+// ordered by key and newest first
+func pageVersions(p *s3.ListObjectVersionsOutput) []objectVersion {
+	versions := make([]objectVersion, 0, len(p.Versions)+len(p.DeleteMarkers))
+	for _, v := range p.Versions {
+		versions = append(versions, objectVersion{
+			key:          aws.StringValue(v.Key),
+			versionID:    aws.StringValue(v.VersionId),
+			latest:       aws.BoolValue(v.IsLatest),
+			size:         aws.Int64Value(v.Size),
+			lastModified: aws.TimeValue(v.LastModified),
+		})
+	}
+	for _, m := range p.DeleteMarkers {
+		versions = append(versions, objectVersion{
+			key:          aws.StringValue(m.Key),
+			versionID:    aws.StringValue(m.VersionId),
+			latest:       aws.BoolValue(m.IsLatest),
+			deleteMarker: true,
+			lastModified: aws.TimeValue(m.LastModified),
+		})
+	}
+	sort.SliceStable(versions, func(i, j int) bool {
+		if versions[i].key != versions[j].key {
+			return versions[i].key < versions[j].key
+		}
+		return versions[i].lastModified.After(versions[j].lastModified)
+	})
+	return versions
+}
+
+// listObjectVersions list all Objects versions and delete markers with prefix in Bucket,
+// modified between startTime and endTime
+func (sc *S3Cli) listObjectVersions(bucket, prefix string, startTime, endTime time.Time) error {
 	lovi := &s3.ListObjectVersionsInput{
 		Bucket: aws.String(bucket),
 	}
 	if prefix != "" {
 		lovi.Prefix = aws.String(prefix)
 	}
-	req, resp := sc.Client.ListObjectVersionsRequest(lovi)
 
 	if sc.presign {
+		req, _ := sc.Client.ListObjectVersionsRequest(lovi)
 		s, err := req.Presign(sc.presignExp)
 		if err == nil {
 			fmt.Println(s)
@@ -641,20 +1080,36 @@ func (sc *S3Cli) listObjectVersions(bucket, prefix string) error {
 		return err
 	}
 
-	err := req.Send()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Key\tVersionId\tLatest\tDeleteMarker\tSize\tLastModified")
+	err := sc.Client.ListObjectVersionsPages(lovi, func(p *s3.ListObjectVersionsOutput, last bool) (shouldContinue bool) {
+		for _, v := range pageVersions(p) {
+			if v.lastModified.Before(startTime) || v.lastModified.After(endTime) {
+				continue
+			}
+			fmt.Fprintf(w, "%s\t%s\t%t\t%t\t%d\t%s\n", v.key, v.versionID, v.latest, v.deleteMarker,
+				v.size, v.lastModified.Format(time.RFC3339))
+		}
+		// flush every page to keep the memory bounded
+		return w.Flush() == nil
+	})
 	if err != nil {
-		return err
-	}
-	if resp == nil {
-		return nil
+		return fmt.Errorf("list object versions failed: %w", err)
 	}
-
-	fmt.Println(resp)
-	return nil
+	return w.Flush()
 }
 
 // getObject download a Object from bucket
 func (sc *S3Cli) getObject(bucket, key, oRange, version string) (io.ReadCloser, error) {
+	resp, err := sc.getObjectOutput(bucket, key, oRange, version, "")
+	if err != nil || resp == nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// getObjectOutput send a GetObject request and return the response, the Object ETag must be ifMatch if not empty
+func (sc *S3Cli) getObjectOutput(bucket, key, oRange, version, ifMatch string) (*s3.GetObjectOutput, error) {
 	var objRange *string
 	if oRange != "" {
 		objRange = aws.String(fmt.Sprintf("bytes=%s", oRange))
@@ -663,12 +1118,18 @@ func (sc *S3Cli) getObject(bucket, key, oRange, version string) (io.ReadCloser,
 	if version != "" {
 		versionID = aws.String(version)
 	}
+	var etag *string
+	if ifMatch != "" {
+		etag = aws.String(ifMatch)
+	}
 	req, resp := sc.Client.GetObjectRequest(&s3.GetObjectInput{
 		Bucket:    aws.String(bucket),
 		Key:       aws.String(key),
 		VersionId: versionID,
 		Range:     objRange,
+		IfMatch:   etag,
 	})
+	req.SetContext(sc.transferContext())
 
 	if sc.presign {
 		s, err := req.Presign(sc.presignExp)
@@ -682,137 +1143,786 @@ func (sc *S3Cli) getObject(bucket, key, oRange, version string) (io.ReadCloser,
 	if err != nil {
 		return nil, fmt.Errorf("get object failed: %w", err)
 	}
-	return resp.Body, nil
+	return resp, nil
+}
 
+// offsetWriter write to an io.WriterAt start from offset
+type offsetWriter struct {
+	w      io.WriterAt
+	offset int64
 }
 
-// catObject print Object contents
-func (sc *S3Cli) catObject(bucket, key, oRange, version string) error {
-	var objRange *string
-	if oRange != "" {
-		objRange = aws.String(fmt.Sprintf("bytes=%s", oRange))
-	}
+func (ow *offsetWriter) Write(p []byte) (int, error) {
+	n, err := ow.w.WriteAt(p, ow.offset)
+	ow.offset += int64(n)
+	return n, err
+}
+
+// statObject head a Object(version) and return the response
+func (sc *S3Cli) statObject(bucket, key, version string) (*s3.HeadObjectOutput, error) {
 	var versionID *string
 	if version != "" {
 		versionID = aws.String(version)
 	}
-	req, resp := sc.Client.GetObjectRequest(&s3.GetObjectInput{
+	req, resp := sc.Client.HeadObjectRequest(&s3.HeadObjectInput{
 		Bucket:    aws.String(bucket),
 		Key:       aws.String(key),
 		VersionId: versionID,
-		Range:     objRange,
 	})
-
-	if sc.presign {
-		s, err := req.Presign(sc.presignExp)
-		if err == nil {
-			fmt.Println(s)
-		}
-		return err
-	}
-
-	err := req.Send()
-	if err != nil {
-		return fmt.Errorf("get object failed: %w", err)
+	if err := req.Send(); err != nil {
+		return nil, fmt.Errorf("head object failed: %w", err)
 	}
-	_, err = io.Copy(os.Stdout, resp.Body)
-	return err
-}
-
-// renameObject rename Object
-func (sc *S3Cli) renameObject(source, bucket, key string) error {
-	// TODO: Copy and Delete Object
-	return fmt.Errorf("not impl")
+	return resp, nil
 }
 
-// copyObjects copy Object to destBucket/key
-func (sc *S3Cli) copyObject(source, bucket, key string) error {
-	req, resp := sc.Client.CopyObjectRequest(&s3.CopyObjectInput{
-		CopySource: aws.String(source),
-		Bucket:     aws.String(bucket),
-		Key:        aws.String(key),
-	})
+// downloadObject download a Object to local file,
+// get byte ranges in parallel if concurrency > 1 and Object size exceeds partSize
+func (sc *S3Cli) downloadObject(bucket, key, version, filename string) error {
+	if sc.resume || sc.concurrency <= 1 || sc.partSize <= 0 {
+		return sc.downloadObjectStream(bucket, key, version, filename)
+	}
 
-	if sc.presign {
-		s, err := req.Presign(sc.presignExp)
-		if err == nil {
-			fmt.Println(s)
-		}
+	head, err := sc.statObject(bucket, key, version)
+	if err != nil {
 		return err
 	}
-
-	err := req.Send()
+	// download to a temp file and rename it to filename when all ranges are done,
+	// nothing is left if any range failed
+	fd, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".*.s3cli-tmp")
 	if err != nil {
-		return fmt.Errorf("copy object failed: %w", err)
+		return err
 	}
-	if sc.verbose {
-		fmt.Println(resp)
-		return nil
+	defer os.Remove(fd.Name())
+	defer fd.Close()
+	// TempFile is created with 0600
+	if err := fd.Chmod(0644); err != nil {
+		return err
 	}
-	return nil
-}
 
-// deleteObjects list and delete Objects
-func (sc *S3Cli) deleteObjects(bucket, prefix string) error {
-	var objNum int64
-	loi := &s3.ListObjectsInput{
-		Bucket: aws.String(bucket),
-		Prefix: aws.String(prefix),
+	size := aws.Int64Value(head.ContentLength)
+	if err := fd.Truncate(size); err != nil {
+		return err
 	}
-	for {
-		req, resp := sc.Client.ListObjectsRequest(loi)
-		err := req.Send()
-		if err != nil {
-			return fmt.Errorf("list object failed: %w", err)
+	sc.progress.addTotal(size)
+	partNum := (size + sc.partSize - 1) / sc.partSize
+	err = runJobs(partNum, sc.concurrency, func(i int64) error {
+		start := i * sc.partSize
+		end := start + sc.partSize - 1
+		if end >= size {
+			end = size - 1
 		}
-		objectNum := len(resp.Contents)
-		if objectNum == 0 {
-			break
+		// all ranges must be of the same Object
+		resp, err := sc.getObjectOutput(bucket, key, fmt.Sprintf("%d-%d", start, end), version, aws.StringValue(head.ETag))
+		if err != nil {
+			return err
 		}
-		if sc.verbose {
-			fmt.Printf("Got %d Objects, ", objectNum)
+		defer resp.Body.Close()
+		n, err := io.Copy(&offsetWriter{w: fd, offset: start}, resp.Body)
+		if err != nil {
+			return fmt.Errorf("download range %d-%d failed: %w", start, end, err)
 		}
-		objects := make([]*s3.ObjectIdentifier, 0, 1000)
-		for _, obj := range resp.Contents {
-			objects = append(objects, &s3.ObjectIdentifier{Key: obj.Key})
+		if n != end-start+1 {
+			return fmt.Errorf("download range %d-%d failed: got %d bytes", start, end, n)
 		}
-		doi := &s3.DeleteObjectsInput{
-			Bucket: aws.String(bucket),
-			Delete: &s3.Delete{
-				Quiet:   aws.Bool(true),
-				Objects: objects,
-			},
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := fd.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(fd.Name(), filename); err != nil {
+		return err
+	}
+	return verifyFile(filename, head.ETag, head.Metadata, sseEncrypted(head.ServerSideEncryption, head.SSECustomerAlgorithm))
+}
+
+// downloadObjectStream download a Object to local file by a single GET.
+// The Object is recorded in a checkpoint file during download,
+// if resume the partial local file is continued from its size.
+func (sc *S3Cli) downloadObjectStream(bucket, key, version, filename string) error {
+	cpFile := filename + getCheckpointSuffix
+	var offset int64
+	var cp *getCheckpoint
+	if sc.resume {
+		var err error
+		if cp, err = loadGetCheckpoint(cpFile); err != nil {
+			return err
 		}
-		deleteReq, _ := sc.Client.DeleteObjectsRequest(doi)
-		if e := deleteReq.Send(); err != nil {
-			fmt.Printf("delete Objects failed: %s", e)
-		} else {
-			objNum = objNum + int64(objectNum)
+	}
+	if cp != nil {
+		head, err := sc.statObject(bucket, key, version)
+		if err != nil {
+			return err
 		}
-		if sc.verbose {
-			fmt.Printf("%d Objects deleted\n", objNum)
+		if cp.Bucket != bucket || cp.Key != key || cp.VersionID != version ||
+			cp.ETag != aws.StringValue(head.ETag) || !cp.LastModified.Equal(aws.TimeValue(head.LastModified)) {
+			return fmt.Errorf("%s/%s changed since partial download, remove %s to restart", bucket, key, cpFile)
 		}
-
-		if resp.NextMarker != nil {
-			loi.Marker = resp.NextMarker
-		} else if resp.IsTruncated != nil && *resp.IsTruncated {
-			loi.Marker = resp.Contents[objectNum-1].Key
-		} else {
-			break
+		fi, err := os.Stat(filename)
+		if err == nil {
+			offset = fi.Size()
+		} else if !os.IsNotExist(err) {
+			return err
 		}
-	}
-	return nil
-}
-
-// deleteBucketAndObjects force delete a Bucket
-func (sc *S3Cli) deleteBucketAndObjects(bucket string, force bool) error {
-	if force {
-		if err := sc.deleteObjects(bucket, ""); err != nil {
+		if offset > cp.Size {
+			return fmt.Errorf("%s is larger than %s/%s, remove %s to restart", filename, bucket, key, cpFile)
+		} else if offset == cp.Size {
+			err := verifyFile(filename, head.ETag, head.Metadata, sseEncrypted(head.ServerSideEncryption, head.SSECustomerAlgorithm))
+			if rerr := cp.remove(); err == nil {
+				err = rerr
+			}
 			return err
 		}
 	}
-	return sc.bucketDelete(bucket)
-}
+
+	var oRange string
+	if offset > 0 {
+		oRange = fmt.Sprintf("%d-", offset)
+	}
+	var ifMatch string
+	if cp != nil {
+		ifMatch = cp.ETag // the Object may change after stat
+	}
+	resp, err := sc.getObjectOutput(bucket, key, oRange, version, ifMatch)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if offset > 0 && resp.ContentRange == nil {
+		return fmt.Errorf("server not support range GET, remove %s to restart", cpFile)
+	}
+	sc.progress.addTotal(aws.Int64Value(resp.ContentLength))
+	if cp == nil {
+		cp = &getCheckpoint{
+			path:         cpFile,
+			Bucket:       bucket,
+			Key:          key,
+			VersionID:    version,
+			ETag:         aws.StringValue(resp.ETag),
+			LastModified: aws.TimeValue(resp.LastModified),
+			Size:         aws.Int64Value(resp.ContentLength),
+		}
+		if err := cp.save(); err != nil {
+			return fmt.Errorf("save checkpoint failed: %w", err)
+		}
+	}
+
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if offset > 0 {
+		flag = os.O_WRONLY | os.O_APPEND
+	}
+	fd, err := os.OpenFile(filename, flag, 0644)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	if _, err := io.Copy(fd, resp.Body); err != nil {
+		return fmt.Errorf("download %s/%s failed: %w, continue it with --continue", bucket, key, err)
+	}
+	if err := fd.Close(); err != nil {
+		return err
+	}
+	if err := verifyFile(filename, resp.ETag, resp.Metadata, sseEncrypted(resp.ServerSideEncryption, resp.SSECustomerAlgorithm)); err != nil {
+		cp.remove()
+		return err
+	}
+	return cp.remove()
+}
+
+// localPath return the local filename of key(without prefix) under dir,
+// return error if the filename escapes dir
+func localPath(dir, prefix, key string) (string, error) {
+	filename := filepath.Join(dir, filepath.FromSlash(strings.TrimPrefix(key, prefix)))
+	rel, err := filepath.Rel(dir, filename)
+	if err != nil {
+		return "", err
+	}
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid key %s, escapes %s", key, dir)
+	}
+	return filename, nil
+}
+
+// getPrefix download all Objects in bucket/prefix to local dir with their relative keys,
+// at most jobs Objects are downloaded in parallel and a summary is printed at the end
+func (sc *S3Cli) getPrefix(bucket, prefix, dir string, jobs int) error {
+	var keys []string
+	err := sc.Client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}, func(p *s3.ListObjectsV2Output, last bool) (shouldContinue bool) {
+		for _, obj := range p.Contents {
+			if !strings.HasSuffix(*obj.Key, "/") { // skip dir Objects
+				keys = append(keys, *obj.Key)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("list all objects failed: %w", err)
+	}
+
+	errs := make([]error, len(keys))
+	runJobs(int64(len(keys)), jobs, func(i int64) error {
+		filename, err := localPath(dir, prefix, keys[i])
+		if err != nil {
+			errs[i] = err
+			return nil
+		}
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			errs[i] = err
+			return nil
+		}
+		errs[i] = sc.downloadObject(bucket, keys[i], "", filename)
+		return nil
+	})
+
+	return printSummary(keys, errs, "Objects downloaded")
+}
+
+// catObject print Object contents
+func (sc *S3Cli) catObject(bucket, key, oRange, version string) error {
+	var objRange *string
+	if oRange != "" {
+		objRange = aws.String(fmt.Sprintf("bytes=%s", oRange))
+	}
+	var versionID *string
+	if version != "" {
+		versionID = aws.String(version)
+	}
+	req, resp := sc.Client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket:    aws.String(bucket),
+		Key:       aws.String(key),
+		VersionId: versionID,
+		Range:     objRange,
+	})
+
+	if sc.presign {
+		s, err := req.Presign(sc.presignExp)
+		if err == nil {
+			fmt.Println(s)
+		}
+		return err
+	}
+
+	err := req.Send()
+	if err != nil {
+		return fmt.Errorf("get object failed: %w", err)
+	}
+	_, err = io.Copy(os.Stdout, resp.Body)
+	return err
+}
+
+// renameObject rename Object by copy and delete, the source is kept if copy failed
+func (sc *S3Cli) renameObject(srcBucket, srcKey, bucket, key string) error {
+	if sc.presign {
+		return fmt.Errorf("presign not support rename")
+	}
+	if srcBucket == bucket && srcKey == key {
+		return fmt.Errorf("rename %s/%s to itself", srcBucket, srcKey)
+	}
+	// never delete the source if copy failed
+	if err := sc.copyObject(srcBucket, srcKey, "", -1, bucket, key); err != nil {
+		return err
+	}
+	if err := sc.deleteObject(srcBucket, srcKey, ""); err != nil {
+		return fmt.Errorf("delete source object failed: %w", err)
+	}
+	return nil
+}
+
+// listKeys list all Object keys with prefix(dir Objects included), sorted
+func (sc *S3Cli) listKeys(bucket, prefix string) ([]string, error) {
+	var keys []string
+	err := sc.Client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}, func(p *s3.ListObjectsV2Output, last bool) (shouldContinue bool) {
+		for _, obj := range p.Contents {
+			keys = append(keys, aws.StringValue(obj.Key))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list all objects failed: %w", err)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// renamePrefix rename all Objects(dir Objects included) with srcPrefix in srcBucket to bucket/prefix,
+// jobs Objects in parallel
+func (sc *S3Cli) renamePrefix(srcBucket, srcPrefix, bucket, prefix string, jobs int) error {
+	if srcBucket == bucket && srcPrefix == prefix {
+		return fmt.Errorf("rename %s/%s to itself", srcBucket, srcPrefix)
+	}
+	// renamed Objects would be listed(and renamed again) or overwritten by the source
+	if srcBucket == bucket && (strings.HasPrefix(prefix, srcPrefix) || strings.HasPrefix(srcPrefix, prefix)) {
+		return fmt.Errorf("rename %s/%s to overlapped prefix %s", srcBucket, srcPrefix, prefix)
+	}
+	names, err := sc.listKeys(srcBucket, srcPrefix)
+	if err != nil {
+		return err
+	}
+	for i := range names {
+		names[i] = strings.TrimPrefix(names[i], srcPrefix)
+	}
+
+	errs := make([]error, len(names))
+	runJobs(int64(len(names)), jobs, func(i int64) error {
+		errs[i] = sc.renameObject(srcBucket, srcPrefix+names[i], bucket, prefix+names[i])
+		return nil
+	})
+	return printSummary(names, errs, "Objects renamed")
+}
+
+// escapeKey URL-encode each path segment of key(CopySource must be URL-encoded)
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, s := range segments {
+		segments[i] = strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+	}
+	return strings.Join(segments, "/")
+}
+
+// copySource return the URL-encoded CopySource of bucket/key, with versionId if version is not empty
+func copySource(bucket, key, version string) string {
+	if version == "" {
+		return fmt.Sprintf("%s/%s", bucket, escapeKey(key))
+	}
+	return fmt.Sprintf("%s/%s?versionId=%s", bucket, escapeKey(key), url.QueryEscape(version))
+}
+
+// restoreVersion copy a version of Object over its current version server-side
+func (sc *S3Cli) restoreVersion(bucket, key, version string) error {
+	return sc.copyObject(bucket, key, version, -1, bucket, key)
+}
+
+// versionBefore return the ID of latest version of Object modified before t
+func (sc *S3Cli) versionBefore(bucket, key string, t time.Time) (string, error) {
+	var latest *s3.ObjectVersion
+	err := sc.Client.ListObjectVersionsPages(&s3.ListObjectVersionsInput{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(key),
+	}, func(p *s3.ListObjectVersionsOutput, last bool) (shouldContinue bool) {
+		for _, v := range p.Versions {
+			if aws.StringValue(v.Key) != key || !aws.TimeValue(v.LastModified).Before(t) {
+				continue
+			}
+			if latest == nil || aws.TimeValue(v.LastModified).After(aws.TimeValue(latest.LastModified)) {
+				latest = v
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return "", fmt.Errorf("list object versions failed: %w", err)
+	}
+	if latest == nil {
+		return "", fmt.Errorf("no version of %s/%s before %s", bucket, key, t)
+	}
+	return aws.StringValue(latest.VersionId), nil
+}
+
+// topDeleteMarkers list the delete markers on top of deleted Objects(the latest is a delete marker)
+// with prefix, which are newer than the latest version of the Object.
+// Only the Object key=prefix is checked if exact
+func (sc *S3Cli) topDeleteMarkers(bucket, prefix string, exact bool) ([]*s3.DeleteMarkerEntry, error) {
+	markers := map[string][]*s3.DeleteMarkerEntry{}
+	latestVersion := map[string]time.Time{}
+	deleted := map[string]bool{}
+	err := sc.Client.ListObjectVersionsPages(&s3.ListObjectVersionsInput{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}, func(p *s3.ListObjectVersionsOutput, last bool) (shouldContinue bool) {
+		for _, m := range p.DeleteMarkers {
+			key := aws.StringValue(m.Key)
+			if exact && key != prefix {
+				continue
+			}
+			markers[key] = append(markers[key], m)
+			if aws.BoolValue(m.IsLatest) {
+				deleted[key] = true
+			}
+		}
+		for _, v := range p.Versions {
+			key := aws.StringValue(v.Key)
+			if t := aws.TimeValue(v.LastModified); t.After(latestVersion[key]) {
+				latestVersion[key] = t
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list object versions failed: %w", err)
+	}
+
+	var top []*s3.DeleteMarkerEntry
+	for key := range deleted {
+		if _, ok := latestVersion[key]; !ok {
+			continue // no version to bring back
+		}
+		for _, m := range markers[key] {
+			if aws.TimeValue(m.LastModified).After(latestVersion[key]) {
+				top = append(top, m)
+			}
+		}
+	}
+	sort.Slice(top, func(i, j int) bool {
+		return aws.StringValue(top[i].Key) < aws.StringValue(top[j].Key)
+	})
+	return top, nil
+}
+
+// undelete remove the delete markers on top of the Object key, or all deleted Objects with prefix
+// if recursive(jobs in parallel), to bring the previous versions back
+func (sc *S3Cli) undelete(bucket, prefix string, recursive bool, jobs int) error {
+	markers, err := sc.topDeleteMarkers(bucket, prefix, !recursive)
+	if err != nil {
+		return err
+	}
+	if len(markers) == 0 {
+		return fmt.Errorf("no deleted Object %s/%s to undelete", bucket, prefix)
+	}
+	items := make([]string, len(markers))
+	errs := make([]error, len(markers))
+	runJobs(int64(len(markers)), jobs, func(i int64) error {
+		items[i] = objectName(markers[i].Key, markers[i].VersionId)
+		errs[i] = sc.deleteObject(bucket, aws.StringValue(markers[i].Key), aws.StringValue(markers[i].VersionId))
+		return nil
+	})
+	return printSummary(items, errs, "delete markers removed")
+}
+
+// copyObjects copy Object srcBucket/srcKey(the version if not empty) to bucket/key,
+// the source Object larger than maxCopySize is copied by Multi-Part-Upload.
+// size is the source Object size if known(listed), or -1 to HEAD it
+func (sc *S3Cli) copyObject(srcBucket, srcKey, version string, size int64, bucket, key string) error {
+	if !sc.presign && (size < 0 || size > maxCopySize) {
+		head, err := sc.statObject(srcBucket, srcKey, version)
+		if err != nil {
+			return fmt.Errorf("head source object failed: %w", err)
+		}
+		if aws.Int64Value(head.ContentLength) > maxCopySize {
+			return sc.mpuCopyObject(srcBucket, srcKey, head, bucket, key)
+		}
+	}
+	req, resp := sc.Client.CopyObjectRequest(&s3.CopyObjectInput{
+		CopySource: aws.String(copySource(srcBucket, srcKey, version)),
+		Bucket:     aws.String(bucket),
+		Key:        aws.String(key),
+	})
+
+	if sc.presign {
+		s, err := req.Presign(sc.presignExp)
+		if err == nil {
+			fmt.Println(s)
+		}
+		return err
+	}
+
+	err := req.Send()
+	if err != nil {
+		return fmt.Errorf("copy object failed: %w", err)
+	}
+	if sc.verbose {
+		fmt.Println(resp)
+		return nil
+	}
+	return nil
+}
+
+// objectTagging return the URL-encoded tag set of Object(for Tagging of CreateMultipartUpload), nil if no tag
+func (sc *S3Cli) objectTagging(bucket, key, version string) (*string, error) {
+	var versionID *string
+	if version != "" {
+		versionID = aws.String(version)
+	}
+	resp, err := sc.Client.GetObjectTagging(&s3.GetObjectTaggingInput{
+		Bucket:    aws.String(bucket),
+		Key:       aws.String(key),
+		VersionId: versionID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get source object tagging failed: %w", err)
+	}
+	if len(resp.TagSet) == 0 {
+		return nil, nil
+	}
+	tags := url.Values{}
+	for _, tag := range resp.TagSet {
+		tags.Add(aws.StringValue(tag.Key), aws.StringValue(tag.Value))
+	}
+	return aws.String(strings.Replace(tags.Encode(), "+", "%20", -1)), nil
+}
+
+// mpuCopyObject copy Object srcBucket/srcKey(the version of its head) to bucket/key by Multi-Part-Upload,
+// parts are copied in parallel by UploadPartCopy and the MPU is aborted if any part failed.
+// The metadata, content headers, storage class, SSE settings and tags of source Object are carried to the new Object
+func (sc *S3Cli) mpuCopyObject(srcBucket, srcKey string, head *s3.HeadObjectOutput, bucket, key string) error {
+	size := aws.Int64Value(head.ContentLength)
+	partSize := sc.partSize
+	if err := checkPartSize(partSize); err != nil {
+		return err
+	}
+	if size > partSize*maxPartNum {
+		partSize = (size + maxPartNum - 1) / maxPartNum
+	}
+	partNum := (size + partSize - 1) / partSize
+
+	tagging, err := sc.objectTagging(srcBucket, srcKey, aws.StringValue(head.VersionId))
+	if err != nil {
+		return err
+	}
+	createResp, err := sc.createUpload(&s3.CreateMultipartUploadInput{
+		Bucket:               aws.String(bucket),
+		Key:                  aws.String(key),
+		Metadata:             head.Metadata,
+		ContentType:          head.ContentType,
+		ContentEncoding:      head.ContentEncoding,
+		ContentDisposition:   head.ContentDisposition,
+		ContentLanguage:      head.ContentLanguage,
+		CacheControl:         head.CacheControl,
+		StorageClass:         head.StorageClass,
+		ServerSideEncryption: head.ServerSideEncryption,
+		SSEKMSKeyId:          head.SSEKMSKeyId,
+		BucketKeyEnabled:     head.BucketKeyEnabled,
+		Tagging:              tagging,
+	})
+	if err != nil {
+		return err
+	}
+	uid := aws.StringValue(createResp.UploadId)
+
+	parts := make([]*s3.CompletedPart, partNum)
+	err = runJobs(partNum, sc.concurrency, func(i int64) error {
+		start := i * partSize
+		end := start + partSize - 1
+		if end >= size {
+			end = size - 1
+		}
+		req, resp := sc.Client.UploadPartCopyRequest(&s3.UploadPartCopyInput{
+			Bucket:          aws.String(bucket),
+			Key:             aws.String(key),
+			CopySource:      aws.String(copySource(srcBucket, srcKey, aws.StringValue(head.VersionId))),
+			CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+			PartNumber:      aws.Int64(i + 1),
+			UploadId:        aws.String(uid),
+		})
+		if err := req.Send(); err != nil {
+			return fmt.Errorf("copy part %d failed: %w", i+1, err)
+		}
+		parts[i] = &s3.CompletedPart{
+			PartNumber: aws.Int64(i + 1),
+			ETag:       resp.CopyPartResult.ETag,
+		}
+		return nil
+	})
+	if err != nil {
+		return sc.abortUpload(bucket, key, uid, err)
+	}
+	return sc.completeUpload(bucket, key, uid, parts, sc.verbose)
+}
+
+// maxDeleteKeys is the maximum number of Objects in a DeleteObjects
+const maxDeleteKeys = 1000
+
+// deleteBatches delete Object batches from batches by DeleteObjects, jobs batches in flight,
+// return the number of deleted Objects and the per-key failures
+func (sc *S3Cli) deleteBatches(bucket string, batches <-chan []*s3.ObjectIdentifier, jobs int) (int64, []string) {
+	if jobs < 1 {
+		jobs = 1
+	}
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		deleted int64
+		failed  []string
+	)
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for objects := range batches {
+				req, resp := sc.Client.DeleteObjectsRequest(&s3.DeleteObjectsInput{
+					Bucket: aws.String(bucket),
+					Delete: &s3.Delete{
+						Quiet:   aws.Bool(true),
+						Objects: objects,
+					},
+				})
+				err := req.Send()
+				mu.Lock()
+				if err != nil {
+					for _, obj := range objects {
+						failed = append(failed, fmt.Sprintf("%s, %s", objectName(obj.Key, obj.VersionId), err))
+					}
+				} else {
+					for _, e := range resp.Errors {
+						failed = append(failed, fmt.Sprintf("%s, %s: %s", objectName(e.Key, e.VersionId), aws.StringValue(e.Code), aws.StringValue(e.Message)))
+					}
+					deleted += int64(len(objects) - len(resp.Errors))
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return deleted, failed
+}
+
+// objectName return key, or key?versionId=version if version is not empty
+func objectName(key, version *string) string {
+	if aws.StringValue(version) == "" {
+		return aws.StringValue(key)
+	}
+	return fmt.Sprintf("%s?versionId=%s", aws.StringValue(key), aws.StringValue(version))
+}
+
+// printDeleteSummary print the per-key failures and the number of deleted Objects,
+// return error if any Object failed
+func printDeleteSummary(deleted int64, failed []string) error {
+	sort.Strings(failed)
+	for _, v := range failed {
+		fmt.Printf("failed:  %s\n", v)
+	}
+	fmt.Printf("%d Objects deleted, %d failed\n", deleted, len(failed))
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d Objects delete failed", len(failed), deleted+int64(len(failed)))
+	}
+	return nil
+}
+
+// deleteKeys delete Objects in batches by DeleteObjects, jobs batches in flight,
+// return error if any Object failed
+func (sc *S3Cli) deleteKeys(bucket string, keys []string, jobs int) error {
+	batches := make(chan []*s3.ObjectIdentifier)
+	go func() {
+		defer close(batches)
+		for start := 0; start < len(keys); start += maxDeleteKeys {
+			end := start + maxDeleteKeys
+			if end > len(keys) {
+				end = len(keys)
+			}
+			objects := make([]*s3.ObjectIdentifier, 0, end-start)
+			for _, key := range keys[start:end] {
+				objects = append(objects, &s3.ObjectIdentifier{Key: aws.String(key)})
+			}
+			batches <- objects
+		}
+	}()
+	return printDeleteSummary(sc.deleteBatches(bucket, batches, jobs))
+}
+
+// maxDeletePasses is the maximum number of list and delete passes of deleteListed
+const maxDeletePasses = 3
+
+// deletePass delete Object(version)s listed by list once, the listed batches are deleted
+// while listing goes on, jobs batches in flight.
+// Return the number of listed and deleted Objects, the per-key failures and list error
+func (sc *S3Cli) deletePass(bucket string, jobs int, list func(send func([]*s3.ObjectIdentifier)) error) (int64, int64, []string, error) {
+	batches := make(chan []*s3.ObjectIdentifier, jobs)
+	var listed int64
+	var listErr error
+	go func() {
+		defer close(batches)
+		listErr = list(func(objects []*s3.ObjectIdentifier) {
+			if len(objects) == 0 {
+				return
+			}
+			if sc.verbose {
+				fmt.Printf("Got %d Objects\n", len(objects))
+			}
+			listed += int64(len(objects))
+			batches <- objects
+		})
+	}()
+	deleted, failed := sc.deleteBatches(bucket, batches, jobs)
+	return listed, deleted, failed, listErr
+}
+
+// deleteListed delete all Object(version)s listed by list, jobs DeleteObjects batches in flight.
+// Listing goes on while deleting, so list again to make sure nothing left behind,
+// return error if any Object failed or left
+func (sc *S3Cli) deleteListed(bucket string, jobs int, list func(send func([]*s3.ObjectIdentifier)) error) error {
+	var deleted int64
+	var failed []string
+	for pass := 1; ; pass++ {
+		listed, n, f, err := sc.deletePass(bucket, jobs, list)
+		deleted += n
+		failed = append(failed, f...)
+		if err != nil {
+			printDeleteSummary(deleted, failed)
+			return fmt.Errorf("list object failed: %w", err)
+		}
+		if listed == 0 || len(f) > 0 {
+			break
+		}
+		if pass == maxDeletePasses {
+			printDeleteSummary(deleted, failed)
+			return fmt.Errorf("still got Objects in %s after %d passes", bucket, pass)
+		}
+	}
+	return printDeleteSummary(deleted, failed)
+}
+
+// deleteObjects list and delete all Objects with prefix, jobs DeleteObjects batches in flight
+func (sc *S3Cli) deleteObjects(bucket, prefix string, jobs int) error {
+	return sc.deleteListed(bucket, jobs, func(send func([]*s3.ObjectIdentifier)) error {
+		return sc.Client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+			Bucket: aws.String(bucket),
+			Prefix: aws.String(prefix),
+		}, func(p *s3.ListObjectsV2Output, last bool) (shouldContinue bool) {
+			objects := make([]*s3.ObjectIdentifier, len(p.Contents))
+			for i, obj := range p.Contents {
+				objects[i] = &s3.ObjectIdentifier{Key: obj.Key}
+			}
+			send(objects)
+			return true
+		})
+	})
+}
+
+// deleteVersions list and delete all Object versions and delete markers with prefix,
+// jobs DeleteObjects batches in flight
+func (sc *S3Cli) deleteVersions(bucket, prefix string, jobs int) error {
+	return sc.deleteListed(bucket, jobs, func(send func([]*s3.ObjectIdentifier)) error {
+		return sc.Client.ListObjectVersionsPages(&s3.ListObjectVersionsInput{
+			Bucket: aws.String(bucket),
+			Prefix: aws.String(prefix),
+		}, func(p *s3.ListObjectVersionsOutput, last bool) (shouldContinue bool) {
+			objects := make([]*s3.ObjectIdentifier, 0, len(p.Versions)+len(p.DeleteMarkers))
+			for _, v := range p.Versions {
+				objects = append(objects, &s3.ObjectIdentifier{Key: v.Key, VersionId: v.VersionId})
+			}
+			for _, v := range p.DeleteMarkers {
+				objects = append(objects, &s3.ObjectIdentifier{Key: v.Key, VersionId: v.VersionId})
+			}
+			send(objects)
+			return true
+		})
+	})
+}
+
+// deleteBucketAndObjects delete a Bucket, force delete all Object versions,
+// delete markers and abort all MPU before delete the Bucket
+func (sc *S3Cli) deleteBucketAndObjects(bucket string, force bool, jobs int) error {
+	if force {
+		if err := sc.deleteVersions(bucket, "", jobs); err != nil {
+			return err
+		}
+		uploads, err := sc.listUploads(bucket, "")
+		if err != nil {
+			return err
+		}
+		if err := sc.abortUploads(bucket, uploads, jobs); err != nil {
+			return err
+		}
+	}
+	return sc.bucketDelete(bucket)
+}
 
 // deleteObject delete a Object(version)
 func (sc *S3Cli) deleteObject(bucket, key, version string) error {
@@ -846,14 +1956,85 @@ func (sc *S3Cli) deleteObject(bucket, key, version string) error {
 
 // mpuCreate create Multi-Part-Upload
 func (sc *S3Cli) mpuCreate(bucket, key string) error {
-	req, resp := sc.Client.CreateMultipartUploadRequest(&s3.CreateMultipartUploadInput{
+	input := &s3.CreateMultipartUploadInput{
 		Bucket: aws.String(bucket),
 		Key:    aws.String(key),
-	})
-	err := req.Send()
+	}
+	if sc.presign {
+		req, _ := sc.Client.CreateMultipartUploadRequest(input)
+		s, err := req.Presign(sc.presignExp)
+		if err == nil {
+			fmt.Println(s)
+		}
+		return err
+	}
+
+	resp, err := sc.createUpload(input)
 	if err != nil {
 		return err
 	}
+	fmt.Println(resp)
+	return nil
+}
+
+// createUpload create a Multi-Part-Upload by input
+func (sc *S3Cli) createUpload(input *s3.CreateMultipartUploadInput) (*s3.CreateMultipartUploadOutput, error) {
+	req, resp := sc.Client.CreateMultipartUploadRequest(input)
+	if err := req.Send(); err != nil {
+		return nil, fmt.Errorf("create MPU failed: %w", err)
+	}
+	return resp, nil
+}
+
+// uploadPart upload a Multi-Part-Upload part and return its ETag
+func (sc *S3Cli) uploadPart(bucket, key, uid string, num int64, body io.ReadSeeker) (string, error) {
+	sum, err := contentMD5(body)
+	if err != nil {
+		return "", err
+	}
+	return sc.uploadPartMD5(bucket, key, uid, num, body, sum)
+}
+
+// uploadPartMD5 upload a Multi-Part-Upload part with its Content-MD5(base64) and return its ETag
+func (sc *S3Cli) uploadPartMD5(bucket, key, uid string, num int64, body io.ReadSeeker, sum string) (string, error) {
+	req, resp := sc.Client.UploadPartRequest(&s3.UploadPartInput{
+		Body:       body,
+		ContentMD5: aws.String(sum),
+		Bucket:     aws.String(bucket),
+		Key:        aws.String(key),
+		PartNumber: aws.Int64(num),
+		UploadId:   aws.String(uid),
+	})
+	req.SetContext(sc.transferContext())
+	if err := req.Send(); err != nil {
+		return "", err
+	}
+	return aws.StringValue(resp.ETag), nil
+}
+
+// abortUpload abort a Multi-Part-Upload because of err, and return err
+func (sc *S3Cli) abortUpload(bucket, key, uid string, err error) error {
+	req, _ := sc.Client.AbortMultipartUploadRequest(&s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uid),
+	})
+	if e := req.Send(); e != nil {
+		return fmt.Errorf("%s, abort MPU %s failed: %w", err, uid, e)
+	}
+	return err
+}
+
+// completeUpload complete a Multi-Part-Upload with the uploaded parts, and print the response if print
+func (sc *S3Cli) completeUpload(bucket, key, uid string, parts []*s3.CompletedPart, print bool) error {
+	req, resp := sc.Client.CompleteMultipartUploadRequest(&s3.CompleteMultipartUploadInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		MultipartUpload: &s3.CompletedMultipartUpload{
+			Parts: parts,
+		},
+		UploadId: aws.String(uid),
+	})
 
 	if sc.presign {
 		s, err := req.Presign(sc.presignExp)
@@ -863,39 +2044,163 @@ func (sc *S3Cli) mpuCreate(bucket, key string) error {
 		return err
 	}
 
-	fmt.Println(resp)
+	if err := req.Send(); err != nil {
+		return fmt.Errorf("complete MPU failed: %w", err)
+	}
+	if print {
+		fmt.Println(resp)
+	}
+	return nil
+}
+
+// retryBackoff is the delay before the first retry, doubled on each retry
+var retryBackoff = time.Second
+
+// retry call fn until it succeeds, fails retries+1 times or fails with an error not retryable,
+// with exponential backoff
+func retry(retries int, fn func() error) error {
+	backoff := retryBackoff
+	err := fn()
+	for i := 0; i < retries && retryable(err); i++ {
+		time.Sleep(backoff)
+		backoff *= 2
+		err = fn()
+	}
 	return err
 }
 
-// mpuUpload do a Multi-Part-Upload
-func (sc *S3Cli) mpuUpload(bucket, key, uid string, file map[int64]string) error {
-	wg := sync.WaitGroup{}
-	for i, localfile := range file {
-		wg.Add(1)
-		go func(num int64, filename string) {
-			defer wg.Done()
-			fd, err := os.Open(filename)
-			if err != nil {
-				fmt.Printf("%2d   error: %s\n", num, err)
-				return
+// uploadPartFile upload a local file as a Multi-Part-Upload part and return its ETag
+func (sc *S3Cli) uploadPartFile(bucket, key, uid string, num int64, filename string) (string, error) {
+	fd, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+	return sc.uploadPart(bucket, key, uid, num, fd)
+}
+
+// retryable check if err is a S3 request error worth a retry(network, throttle, 5xx...),
+// local I/O errors and other S3 errors(invalid part number...) are never retried
+func retryable(err error) bool {
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) {
+		return false
+	}
+	if rf, ok := aerr.(awserr.RequestFailure); ok && rf.StatusCode() >= 500 && rf.StatusCode() != 501 {
+		return true
+	}
+	return request.IsErrorRetryable(aerr) || request.IsErrorThrottle(aerr)
+}
+
+// mpuUpload upload Multi-Part-Upload parts from local files, at most jobs parts in parallel
+func (sc *S3Cli) mpuUpload(bucket, key, uid string, files map[int64]string, jobs, retries int) error {
+	nums := make([]int64, 0, len(files))
+	for num := range files {
+		nums = append(nums, num)
+	}
+	sort.Slice(nums, func(i, j int) bool { return nums[i] < nums[j] })
+	for _, num := range nums {
+		if fi, err := os.Stat(files[num]); err == nil {
+			sc.progress.addTotal(fi.Size())
+		}
+	}
+	return sc.mpuUploadParts(nums, jobs, retries, func(sc *S3Cli, num int64) (string, error) {
+		etag, err := sc.uploadPartFile(bucket, key, uid, num, files[num])
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", files[num], err)
+		}
+		return etag, nil
+	})
+}
+
+// mpuUploadFile upload byte ranges(partSize) of a local file as Multi-Part-Upload parts,
+// only the specified part numbers if parts is not empty(to re-upload failed parts)
+func (sc *S3Cli) mpuUploadFile(bucket, key, uid, filename string, partSize int64, parts []int64, jobs, retries int) error {
+	if err := checkPartSize(partSize); err != nil {
+		return err
+	}
+	fd, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	fi, err := fd.Stat()
+	if err != nil {
+		return err
+	}
+	size := fi.Size()
+	partNum := (size + partSize - 1) / partSize
+	if partNum == 0 {
+		partNum = 1 // a zero-size file is uploaded as an empty part
+	}
+	if partNum > maxPartNum {
+		return fmt.Errorf("%s is split into %d parts, exceeds %d, use a larger part size", filename, partNum, maxPartNum)
+	}
+
+	nums := parts
+	if len(nums) == 0 {
+		for num := int64(1); num <= partNum; num++ {
+			nums = append(nums, num)
+		}
+	}
+	partRange := func(num int64) (int64, int64) {
+		offset := (num - 1) * partSize
+		n := partSize
+		if offset+n > size {
+			n = size - offset
+		}
+		return offset, n
+	}
+	for _, num := range nums {
+		if num < 1 || num > partNum {
+			return fmt.Errorf("invalid part number %d, %s has %d parts", num, filename, partNum)
+		}
+		_, n := partRange(num)
+		sc.progress.addTotal(n)
+	}
+	return sc.mpuUploadParts(nums, jobs, retries, func(sc *S3Cli, num int64) (string, error) {
+		offset, n := partRange(num)
+		return sc.uploadPart(bucket, key, uid, num, io.NewSectionReader(fd, offset, n))
+	})
+}
+
+// mpuUploadParts upload parts(sorted part numbers) by upload, at most jobs parts in parallel,
+// each part is retried with backoff. The ETags are printed in part number order,
+// one per line, to feed into mpu complete. If some parts failed, the uploaded parts
+// are printed as part-number ETag
+func (sc *S3Cli) mpuUploadParts(nums []int64, jobs, retries int, upload func(sc *S3Cli, num int64) (string, error)) error {
+	etags := make([]string, len(nums))
+	errs := make([]error, len(nums))
+	runJobs(int64(len(nums)), jobs, func(i int64) error {
+		errs[i] = retry(retries, func() (err error) {
+			// the bytes of a failed attempt are not counted in progress
+			attempt := *sc
+			attempt.progress = sc.progress.attempt()
+			if etags[i], err = upload(&attempt, nums[i]); err != nil {
+				attempt.progress.reset()
 			}
-			defer fd.Close()
-			req, resp := sc.Client.UploadPartRequest(&s3.UploadPartInput{
-				Body:       fd,
-				Bucket:     aws.String(bucket),
-				Key:        aws.String(key),
-				PartNumber: aws.Int64(num),
-				UploadId:   aws.String(uid),
-			})
-			err = req.Send()
-			if err != nil {
-				fmt.Printf("%2d   error: %s\n", num, err)
-				return
+			return err
+		})
+		return nil
+	})
+
+	var failed []string
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("part %d: %s", nums[i], err))
+		}
+	}
+	if len(failed) > 0 {
+		for i, err := range errs {
+			if err == nil {
+				fmt.Println(nums[i], etags[i])
 			}
-			fmt.Printf("%2d success: %s\n", num, *resp.ETag)
-		}(i, localfile)
+		}
+		return fmt.Errorf("%d of %d parts upload failed:\n%s", len(failed), len(nums), strings.Join(failed, "\n"))
+	}
+	for _, etag := range etags {
+		fmt.Println(etag)
 	}
-	wg.Wait()
 	return nil
 }
 
@@ -923,22 +2228,44 @@ func (sc *S3Cli) mpuAbort(bucket, key, uid string) error {
 	return err
 }
 
-// mpuList list Multi-Part-Uploads
-func (sc *S3Cli) mpuList(bucket, prefix string) error {
-	var keyPrefix *string
-	if prefix != "" {
-		keyPrefix = aws.String(prefix)
-	}
-	req, resp := sc.Client.ListMultipartUploadsRequest(&s3.ListMultipartUploadsInput{
+// listUploads list all Multi-Part-Uploads with prefix
+func (sc *S3Cli) listUploads(bucket, prefix string) ([]*s3.MultipartUpload, error) {
+	var uploads []*s3.MultipartUpload
+	err := sc.Client.ListMultipartUploadsPages(&s3.ListMultipartUploadsInput{
 		Bucket: aws.String(bucket),
-		Prefix: keyPrefix,
+		Prefix: aws.String(prefix),
+	}, func(p *s3.ListMultipartUploadsOutput, last bool) (shouldContinue bool) {
+		uploads = append(uploads, p.Uploads...)
+		return true
 	})
-	err := req.Send()
+	if isNoSuchUpload(err) {
+		return nil, nil // some S3 compatible servers return NoSuchUpload if no upload in Bucket
+	}
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("list MPU failed: %w", err)
+	}
+	return uploads, nil
+}
+
+// formatAge format a duration as age, like 3d2h, 5h12m, 8m
+func formatAge(d time.Duration) string {
+	switch {
+	case d >= 24*time.Hour:
+		return fmt.Sprintf("%dd%dh", d/(24*time.Hour), d%(24*time.Hour)/time.Hour)
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh%dm", d/time.Hour, d%time.Hour/time.Minute)
+	default:
+		return fmt.Sprintf("%dm", d/time.Minute)
 	}
+}
 
+// mpuList list all Multi-Part-Uploads in a table with initiation time and age
+func (sc *S3Cli) mpuList(bucket, prefix string) error {
 	if sc.presign {
+		req, _ := sc.Client.ListMultipartUploadsRequest(&s3.ListMultipartUploadsInput{
+			Bucket: aws.String(bucket),
+			Prefix: aws.String(prefix),
+		})
 		s, err := req.Presign(sc.presignExp)
 		if err == nil {
 			fmt.Println(s)
@@ -946,11 +2273,93 @@ func (sc *S3Cli) mpuList(bucket, prefix string) error {
 		return err
 	}
 
-	fmt.Println(resp)
-	return err
+	uploads, err := sc.listUploads(bucket, prefix)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Initiated\tAge\tKey\tUploadId")
+	for _, u := range uploads {
+		initiated := aws.TimeValue(u.Initiated)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", initiated.Format(time.RFC3339), formatAge(now.Sub(initiated)),
+			aws.StringValue(u.Key), aws.StringValue(u.UploadId))
+	}
+	return w.Flush()
+}
+
+// mpuAbortOlder abort Multi-Part-Uploads with prefix initiated more than age ago, jobs uploads in parallel,
+// only list them in dry-run mode
+func (sc *S3Cli) mpuAbortOlder(bucket, prefix string, age time.Duration, jobs int, dryRun bool) error {
+	uploads, err := sc.listUploads(bucket, prefix)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(-age)
+	var stale []*s3.MultipartUpload
+	for _, u := range uploads {
+		if aws.TimeValue(u.Initiated).Before(deadline) {
+			stale = append(stale, u)
+		}
+	}
+	if dryRun {
+		for _, u := range stale {
+			fmt.Printf("would abort: %s %s\n", aws.StringValue(u.Key), aws.StringValue(u.UploadId))
+		}
+		fmt.Printf("%d would be aborted\n", len(stale))
+		return nil
+	}
+
+	return sc.abortUploads(bucket, stale, jobs)
+}
+
+// abortUploads abort Multi-Part-Uploads, jobs uploads in parallel
+func (sc *S3Cli) abortUploads(bucket string, uploads []*s3.MultipartUpload, jobs int) error {
+	items := make([]string, len(uploads))
+	errs := make([]error, len(uploads))
+	runJobs(int64(len(uploads)), jobs, func(i int64) error {
+		items[i] = fmt.Sprintf("%s %s", aws.StringValue(uploads[i].Key), aws.StringValue(uploads[i].UploadId))
+		req, _ := sc.Client.AbortMultipartUploadRequest(&s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(bucket),
+			Key:      uploads[i].Key,
+			UploadId: uploads[i].UploadId,
+		})
+		errs[i] = req.Send()
+		return nil
+	})
+	return printSummary(items, errs, "MPU aborted")
+}
+
+// listParts list all uploaded parts of a Multi-Part-Upload
+func (sc *S3Cli) listParts(bucket, key, uid string) ([]*s3.Part, error) {
+	var parts []*s3.Part
+	err := sc.Client.ListPartsPages(&s3.ListPartsInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uid),
+	}, func(p *s3.ListPartsOutput, last bool) (shouldContinue bool) {
+		parts = append(parts, p.Parts...)
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list parts failed: %w", err)
+	}
+	return parts, nil
+}
+
+// mpuParts print the part number, size and ETag of uploaded parts of a Multi-Part-Upload
+func (sc *S3Cli) mpuParts(bucket, key, uid string) error {
+	parts, err := sc.listParts(bucket, key, uid)
+	if err != nil {
+		return err
+	}
+	for _, p := range parts {
+		fmt.Printf("%d\t%d\t%s\n", aws.Int64Value(p.PartNumber), aws.Int64Value(p.Size), aws.StringValue(p.ETag))
+	}
+	return nil
 }
 
-// mpuComplete completa Multi-Part-Upload
+// mpuComplete completa Multi-Part-Upload, etags are numbered 1..n by their position
 func (sc *S3Cli) mpuComplete(bucket, key, uid string, etags []string) error {
 	parts := make([]*s3.CompletedPart, len(etags))
 	for i, v := range etags {
@@ -959,27 +2368,25 @@ func (sc *S3Cli) mpuComplete(bucket, key, uid string, etags []string) error {
 			ETag:       aws.String(v),
 		}
 	}
-	req, resp := sc.Client.CompleteMultipartUploadRequest(&s3.CompleteMultipartUploadInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
-		MultipartUpload: &s3.CompletedMultipartUpload{
-			Parts: parts,
-		},
-		UploadId: aws.String(uid),
-	})
-
-	if sc.presign {
-		s, err := req.Presign(sc.presignExp)
-		if err == nil {
-			fmt.Println(s)
-		}
-		return err
-	}
+	return sc.completeUpload(bucket, key, uid, parts, true)
+}
 
-	err := req.Send()
+// mpuCompleteAuto complete Multi-Part-Upload with all uploaded parts listed by ListParts
+func (sc *S3Cli) mpuCompleteAuto(bucket, key, uid string) error {
+	uploaded, err := sc.listParts(bucket, key, uid)
 	if err != nil {
 		return err
 	}
-	fmt.Println(resp)
-	return err
+	if len(uploaded) == 0 {
+		return fmt.Errorf("no part uploaded to %s", uid)
+	}
+	parts := make([]*s3.CompletedPart, len(uploaded))
+	for i, p := range uploaded {
+		parts[i] = &s3.CompletedPart{
+			PartNumber: p.PartNumber,
+			ETag:       p.ETag,
+		}
+	}
+	sort.Slice(parts, func(i, j int) bool { return *parts[i].PartNumber < *parts[j].PartNumber })
+	return sc.completeUpload(bucket, key, uid, parts, true)
 }
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// syncOptions control how sync compare and transfer files/Objects
+type syncOptions struct {
+	checksum  bool // compare MD5 with ETag instead of size and mtime
+	jobs      int  // number of parallel transfers
+	delete    bool // delete destination files/Objects not exist in source
+	maxDelete int  // refuse to delete if more than maxDelete files/Objects(0 means no limit)
+	dryRun    bool // list files/Objects to delete without deleting
+}
+
+// listRemoteObjects list all Objects in bucket/prefix, keyed by relative key(without prefix)
+func (sc *S3Cli) listRemoteObjects(bucket, prefix string) (map[string]*s3.Object, error) {
+	objects := map[string]*s3.Object{}
+	err := sc.Client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}, func(p *s3.ListObjectsV2Output, last bool) (shouldContinue bool) {
+		for _, obj := range p.Contents {
+			if !strings.HasSuffix(*obj.Key, "/") { // skip dir Objects
+				objects[strings.TrimPrefix(*obj.Key, prefix)] = obj
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list all objects failed: %w", err)
+	}
+	return objects, nil
+}
+
+// etagMD5 return the MD5 in ETag, false if the ETag is not a MD5(MPU Object)
+func etagMD5(etag *string) (string, bool) {
+	e := strings.Trim(aws.StringValue(etag), `"`)
+	if len(e) != md5.Size*2 || strings.Contains(e, "-") {
+		return "", false
+	}
+	return e, true
+}
+
+// fileMD5 return the hex MD5 of a local file
+func fileMD5(filename string) (string, error) {
+	fd, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, fd); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// uploadNeeded check if a local file is missing or changed in remote
+func uploadNeeded(filename string, fi os.FileInfo, obj *s3.Object, checksum bool) (bool, error) {
+	if obj == nil || aws.Int64Value(obj.Size) != fi.Size() {
+		return true, nil
+	}
+	if checksum {
+		if etag, ok := etagMD5(obj.ETag); ok {
+			sum, err := fileMD5(filename)
+			if err != nil {
+				return false, err
+			}
+			return sum != etag, nil
+		}
+	}
+	return fi.ModTime().After(aws.TimeValue(obj.LastModified)), nil
+}
+
+// downloadNeeded check if an Object is missing or changed in local
+func downloadNeeded(filename string, obj *s3.Object, checksum bool) (bool, error) {
+	fi, err := os.Stat(filename)
+	if os.IsNotExist(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	if aws.Int64Value(obj.Size) != fi.Size() {
+		return true, nil
+	}
+	if checksum {
+		if etag, ok := etagMD5(obj.ETag); ok {
+			sum, err := fileMD5(filename)
+			if err != nil {
+				return false, err
+			}
+			return sum != etag, nil
+		}
+	}
+	// the mtime of a synced file is set to the Object LastModified
+	lastModified := aws.TimeValue(obj.LastModified).Truncate(time.Second)
+	return !fi.ModTime().Truncate(time.Second).Equal(lastModified), nil
+}
+
+// copyNeeded check if a source Object is missing or changed in destination
+func copyNeeded(src, dst *s3.Object, checksum bool) bool {
+	if dst == nil || aws.Int64Value(src.Size) != aws.Int64Value(dst.Size) {
+		return true
+	}
+	if checksum && src.ETag != nil && dst.ETag != nil {
+		return *src.ETag != *dst.ETag
+	}
+	return aws.TimeValue(src.LastModified).After(aws.TimeValue(dst.LastModified))
+}
+
+// printSyncSummary print the result of synced or failed items, the up-to-date items are counted only
+func printSyncSummary(items []string, synced []bool, errs []error, done string) error {
+	var changed []string
+	var changedErrs []error
+	for i := range items {
+		if synced[i] || errs[i] != nil {
+			changed = append(changed, items[i])
+			changedErrs = append(changedErrs, errs[i])
+		}
+	}
+	fmt.Printf("%d up-to-date\n", len(items)-len(changed))
+	return printSummary(changed, changedErrs, done)
+}
+
+// planDelete check items to delete against maxDelete, list them in dry-run mode,
+// return true if the items should be deleted
+func planDelete(items []string, opt syncOptions) (bool, error) {
+	if len(items) == 0 {
+		return false, nil
+	}
+	if opt.maxDelete > 0 && len(items) > opt.maxDelete {
+		return false, fmt.Errorf("refuse to delete %d items, exceeds --max-delete %d", len(items), opt.maxDelete)
+	}
+	if opt.dryRun {
+		for _, v := range items {
+			fmt.Printf("would delete: %s\n", v)
+		}
+		fmt.Printf("%d would be deleted\n", len(items))
+		return false, nil
+	}
+	return true, nil
+}
+
+// syncDeleteObjects delete destination Objects not exist in source
+func (sc *S3Cli) syncDeleteObjects(bucket string, keys []string, opt syncOptions) error {
+	sort.Strings(keys)
+	if ok, err := planDelete(keys, opt); !ok {
+		return err
+	}
+	return sc.deleteKeys(bucket, keys, opt.jobs)
+}
+
+// syncDeleteFiles delete local files not exist in source
+func syncDeleteFiles(dir string, names []string, opt syncOptions) error {
+	sort.Strings(names)
+	if ok, err := planDelete(names, opt); !ok {
+		return err
+	}
+	errs := make([]error, len(names))
+	for i, name := range names {
+		errs[i] = os.Remove(filepath.Join(dir, filepath.FromSlash(name)))
+	}
+	return printSummary(names, errs, "files deleted")
+}
+
+// syncLocalToBucket upload new or changed files in local dir to bucket/prefix
+func (sc *S3Cli) syncLocalToBucket(dir, bucket, prefix string, opt syncOptions) error {
+	files, err := listLocalFiles(dir)
+	if err != nil {
+		return err
+	}
+	objects, err := sc.listRemoteObjects(bucket, prefix)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	synced := make([]bool, len(names))
+	errs := make([]error, len(names))
+	runJobs(int64(len(names)), opt.jobs, func(i int64) error {
+		filename := filepath.Join(dir, filepath.FromSlash(names[i]))
+		changed, err := uploadNeeded(filename, files[names[i]], objects[names[i]], opt.checksum)
+		if err != nil || !changed {
+			errs[i] = err
+			return nil
+		}
+		errs[i] = sc.putFile(bucket, prefix+names[i], filename)
+		synced[i] = errs[i] == nil
+		return nil
+	})
+	if err := printSyncSummary(names, synced, errs, "files uploaded"); err != nil || !opt.delete {
+		return err
+	}
+	var extra []string
+	for name := range objects {
+		if _, ok := files[name]; !ok {
+			extra = append(extra, prefix+name)
+		}
+	}
+	return sc.syncDeleteObjects(bucket, extra, opt)
+}
+
+// syncBucketToLocal download new or changed Objects in bucket/prefix to local dir,
+// the mtime of downloaded file is set to the Object LastModified
+func (sc *S3Cli) syncBucketToLocal(bucket, prefix, dir string, opt syncOptions) error {
+	objects, err := sc.listRemoteObjects(bucket, prefix)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(objects))
+	for name := range objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	synced := make([]bool, len(names))
+	errs := make([]error, len(names))
+	runJobs(int64(len(names)), opt.jobs, func(i int64) error {
+		obj := objects[names[i]]
+		filename, err := localPath(dir, "", names[i])
+		if err != nil {
+			errs[i] = err
+			return nil
+		}
+		changed, err := downloadNeeded(filename, obj, opt.checksum)
+		if err != nil || !changed {
+			errs[i] = err
+			return nil
+		}
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			errs[i] = err
+			return nil
+		}
+		if err := sc.downloadObject(bucket, *obj.Key, "", filename); err != nil {
+			errs[i] = err
+			return nil
+		}
+		lastModified := aws.TimeValue(obj.LastModified)
+		errs[i] = os.Chtimes(filename, lastModified, lastModified)
+		synced[i] = errs[i] == nil
+		return nil
+	})
+	if err := printSyncSummary(names, synced, errs, "Objects downloaded"); err != nil || !opt.delete {
+		return err
+	}
+	files, err := listLocalFiles(dir)
+	if err != nil {
+		return err
+	}
+	var extra []string
+	for name := range files {
+		if _, ok := objects[name]; !ok {
+			extra = append(extra, name)
+		}
+	}
+	return syncDeleteFiles(dir, extra, opt)
+}
+
+// syncBucketToBucket copy new or changed Objects in srcBucket/srcPrefix to bucket/prefix server-side
+func (sc *S3Cli) syncBucketToBucket(srcBucket, srcPrefix, bucket, prefix string, opt syncOptions) error {
+	srcObjects, err := sc.listRemoteObjects(srcBucket, srcPrefix)
+	if err != nil {
+		return err
+	}
+	dstObjects, err := sc.listRemoteObjects(bucket, prefix)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(srcObjects))
+	for name := range srcObjects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	synced := make([]bool, len(names))
+	errs := make([]error, len(names))
+	runJobs(int64(len(names)), opt.jobs, func(i int64) error {
+		obj := srcObjects[names[i]]
+		if !copyNeeded(obj, dstObjects[names[i]], opt.checksum) {
+			return nil
+		}
+		errs[i] = sc.copyObject(srcBucket, *obj.Key, "", aws.Int64Value(obj.Size), bucket, prefix+names[i])
+		synced[i] = errs[i] == nil
+		return nil
+	})
+	if err := printSyncSummary(names, synced, errs, "Objects copied"); err != nil || !opt.delete {
+		return err
+	}
+	var extra []string
+	for name := range dstObjects {
+		if _, ok := srcObjects[name]; !ok {
+			extra = append(extra, prefix+name)
+		}
+	}
+	return sc.syncDeleteObjects(bucket, extra, opt)
+}
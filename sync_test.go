@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func Test_etagMD5(t *testing.T) {
+	cases := map[string]string{
+		`"d41d8cd98f00b204e9800998ecf8427e"`:   "d41d8cd98f00b204e9800998ecf8427e",
+		"d41d8cd98f00b204e9800998ecf8427e":     "d41d8cd98f00b204e9800998ecf8427e",
+		`"d41d8cd98f00b204e9800998ecf8427e-2"`: "",
+		"":                                     "",
+	}
+	for k, v := range cases {
+		sum, ok := etagMD5(aws.String(k))
+		if sum != v || ok != (v != "") {
+			t.Errorf("etagMD5 %s expect: %s, got: %s, %v", k, v, sum, ok)
+		}
+	}
+}
+
+func Test_uploadNeeded(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "file")
+	if err := ioutil.WriteFile(filename, testObjectContent, 0644); err != nil {
+		t.Errorf("uploadNeeded write file failed: %s", err)
+		return
+	}
+	fi, err := os.Stat(filename)
+	if err != nil {
+		t.Errorf("uploadNeeded stat file failed: %s", err)
+		return
+	}
+	sum, err := fileMD5(filename)
+	if err != nil {
+		t.Errorf("uploadNeeded fileMD5 failed: %s", err)
+		return
+	}
+	size := int64(len(testObjectContent))
+	cases := []struct {
+		obj      *s3.Object
+		checksum bool
+		expect   bool
+	}{
+		{nil, false, true},
+		{&s3.Object{Size: aws.Int64(size + 1), LastModified: aws.Time(fi.ModTime().Add(time.Hour))}, false, true},
+		{&s3.Object{Size: aws.Int64(size), LastModified: aws.Time(fi.ModTime().Add(-time.Hour))}, false, true},
+		{&s3.Object{Size: aws.Int64(size), LastModified: aws.Time(fi.ModTime().Add(time.Hour))}, false, false},
+		{&s3.Object{Size: aws.Int64(size), ETag: aws.String(`"` + sum + `"`), LastModified: aws.Time(fi.ModTime().Add(-time.Hour))}, true, false},
+		{&s3.Object{Size: aws.Int64(size), ETag: aws.String(`"00000000000000000000000000000000"`), LastModified: aws.Time(fi.ModTime().Add(time.Hour))}, true, true},
+	}
+	for i, v := range cases {
+		got, err := uploadNeeded(filename, fi, v.obj, v.checksum)
+		if err != nil || got != v.expect {
+			t.Errorf("uploadNeeded case %d expect: %v, got: %v, %v", i, v.expect, got, err)
+		}
+	}
+}
+
+func Test_syncLocalToBucket(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{"a.txt", "sub/b.txt"}
+	for _, v := range files {
+		filename := filepath.Join(dir, filepath.FromSlash(v))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Errorf("syncLocalToBucket mkdir failed: %s", err)
+			return
+		}
+		if err := ioutil.WriteFile(filename, testObjectContent, 0644); err != nil {
+			t.Errorf("syncLocalToBucket write file failed: %s", err)
+			return
+		}
+	}
+	opt := syncOptions{checksum: true, jobs: 2}
+	if err := s3cliTest.syncLocalToBucket(dir, testBucketName, "testSyncUp/", opt); err != nil {
+		t.Errorf("syncLocalToBucket failed: %s", err)
+		return
+	}
+	for _, v := range files {
+		if _, err := s3Backend.HeadObject(testBucketName, "testSyncUp/"+v); err != nil {
+			t.Errorf("syncLocalToBucket backend HeadObject %s failed: %s", v, err)
+		}
+	}
+	// nothing changed
+	if err := s3cliTest.syncLocalToBucket(dir, testBucketName, "testSyncUp/", opt); err != nil {
+		t.Errorf("syncLocalToBucket again failed: %s", err)
+	}
+}
+
+func Test_syncBucketToLocal(t *testing.T) {
+	keys := []string{"testSyncDown/a.txt", "testSyncDown/sub/b.txt"}
+	for _, v := range keys {
+		if err := s3cliTest.putObject(testBucketName, v, bytes.NewReader(testObjectContent)); err != nil {
+			t.Errorf("syncBucketToLocal putObject failed: %s", err)
+			return
+		}
+	}
+	dir := t.TempDir()
+	opt := syncOptions{jobs: 2}
+	if err := s3cliTest.syncBucketToLocal(testBucketName, "testSyncDown/", dir, opt); err != nil {
+		t.Errorf("syncBucketToLocal failed: %s", err)
+		return
+	}
+	objects, err := s3cliTest.listRemoteObjects(testBucketName, "testSyncDown/")
+	if err != nil {
+		t.Errorf("syncBucketToLocal listRemoteObjects failed: %s", err)
+		return
+	}
+	for name, obj := range objects {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		changed, err := downloadNeeded(filename, obj, false)
+		if err != nil || changed {
+			t.Errorf("syncBucketToLocal %s not synced: %v, %v", name, changed, err)
+		}
+	}
+}
+
+func Test_copyNeeded(t *testing.T) {
+	now := time.Now()
+	src := &s3.Object{Size: aws.Int64(10), ETag: aws.String(`"etag1"`), LastModified: aws.Time(now)}
+	cases := []struct {
+		dst      *s3.Object
+		checksum bool
+		expect   bool
+	}{
+		{nil, false, true},
+		{&s3.Object{Size: aws.Int64(11), ETag: aws.String(`"etag1"`), LastModified: aws.Time(now.Add(time.Hour))}, false, true},
+		{&s3.Object{Size: aws.Int64(10), ETag: aws.String(`"etag2"`), LastModified: aws.Time(now.Add(-time.Hour))}, false, true},
+		{&s3.Object{Size: aws.Int64(10), ETag: aws.String(`"etag2"`), LastModified: aws.Time(now.Add(time.Hour))}, false, false},
+		{&s3.Object{Size: aws.Int64(10), ETag: aws.String(`"etag1"`), LastModified: aws.Time(now.Add(-time.Hour))}, true, false},
+		{&s3.Object{Size: aws.Int64(10), ETag: aws.String(`"etag2"`), LastModified: aws.Time(now.Add(time.Hour))}, true, true},
+	}
+	for i, v := range cases {
+		if got := copyNeeded(src, v.dst, v.checksum); got != v.expect {
+			t.Errorf("copyNeeded case %d expect: %v, got: %v", i, v.expect, got)
+		}
+	}
+}
+
+func Test_syncBucketToBucket(t *testing.T) {
+	keys := []string{"testSyncSrc/a.txt", "testSyncSrc/sub/b.txt", "testSyncSrc/a b+c%d?.txt", "testSyncSrc/ü/é.txt"}
+	for _, v := range keys {
+		if err := s3cliTest.putObject(testBucketName, v, bytes.NewReader(testObjectContent)); err != nil {
+			t.Errorf("syncBucketToBucket putObject failed: %s", err)
+			return
+		}
+	}
+	opt := syncOptions{jobs: 2}
+	if err := s3cliTest.syncBucketToBucket(testBucketName, "testSyncSrc/", testBucketName, "testSyncDst/", opt); err != nil {
+		t.Errorf("syncBucketToBucket failed: %s", err)
+		return
+	}
+	for _, v := range []string{"a.txt", "sub/b.txt", "a b+c%d?.txt", "ü/é.txt"} {
+		if _, err := s3Backend.HeadObject(testBucketName, "testSyncDst/"+v); err != nil {
+			t.Errorf("syncBucketToBucket backend HeadObject %s failed: %s", v, err)
+		}
+	}
+}
+
+func Test_planDelete(t *testing.T) {
+	items := []string{"a", "b", "c"}
+	if ok, err := planDelete(nil, syncOptions{}); ok || err != nil {
+		t.Errorf("planDelete empty expect: false, nil, got: %v, %v", ok, err)
+	}
+	if ok, err := planDelete(items, syncOptions{}); !ok || err != nil {
+		t.Errorf("planDelete expect: true, nil, got: %v, %v", ok, err)
+	}
+	if ok, err := planDelete(items, syncOptions{maxDelete: 2}); ok || err == nil {
+		t.Errorf("planDelete max-delete expect: false, error, got: %v, %v", ok, err)
+	}
+	if ok, err := planDelete(items, syncOptions{maxDelete: 3, dryRun: true}); ok || err != nil {
+		t.Errorf("planDelete dry-run expect: false, nil, got: %v, %v", ok, err)
+	}
+}
+
+func Test_syncDelete(t *testing.T) {
+	bucket := "bucket4sync"
+	if err := s3Backend.CreateBucket(bucket); err != nil {
+		t.Errorf("syncDelete backend CreateBucket failed: %s", err)
+		return
+	}
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.txt"), testObjectContent, 0644); err != nil {
+		t.Errorf("syncDelete write file failed: %s", err)
+		return
+	}
+	for _, v := range []string{"testSyncDelete/a.txt", "testSyncDelete/extra.txt"} {
+		if err := s3cliTest.putObject(bucket, v, bytes.NewReader(testObjectContent)); err != nil {
+			t.Errorf("syncDelete putObject failed: %s", err)
+			return
+		}
+	}
+
+	opt := syncOptions{jobs: 2, delete: true, dryRun: true}
+	if err := s3cliTest.syncLocalToBucket(dir, bucket, "testSyncDelete/", opt); err != nil {
+		t.Errorf("syncDelete dry-run failed: %s", err)
+		return
+	}
+	if _, err := s3Backend.HeadObject(bucket, "testSyncDelete/extra.txt"); err != nil {
+		t.Errorf("syncDelete dry-run deleted Object: %s", err)
+	}
+
+	opt.dryRun = false
+	if err := s3cliTest.syncLocalToBucket(dir, bucket, "testSyncDelete/", opt); err != nil {
+		t.Errorf("syncDelete failed: %s", err)
+		return
+	}
+	if _, err := s3Backend.HeadObject(bucket, "testSyncDelete/extra.txt"); err == nil {
+		t.Errorf("syncDelete Object not deleted")
+	}
+
+	// mirror Bucket to local dir
+	if err := ioutil.WriteFile(filepath.Join(dir, "extra.txt"), testObjectContent, 0644); err != nil {
+		t.Errorf("syncDelete write file failed: %s", err)
+		return
+	}
+	if err := s3cliTest.syncBucketToLocal(bucket, "testSyncDelete/", dir, opt); err != nil {
+		t.Errorf("syncDelete to local failed: %s", err)
+		return
+	}
+	if _, err := os.Stat(filepath.Join(dir, "extra.txt")); !os.IsNotExist(err) {
+		t.Errorf("syncDelete file not deleted: %v", err)
+	}
+}